@@ -46,7 +46,10 @@ func main() {
 		panic(err)
 	}
 
-	record := parser.NewRecordFromReplay(rr)
+	record, err := parser.NewRecordFromReplay(rr)
+	if err != nil {
+		panic(err)
+	}
 
 	log.Printf("%s (%s) MVP: %s", record.Home.Name, record.Home.Race, record.Home.MVP)
 	log.Printf("%s (%s) MVP: %s", record.Away.Name, record.Away.Race, record.Away.MVP)
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/helper"
+)
+
+func UnmappedIDsHandler(db database.DB) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.GetUnmappedIDs()
+		if err != nil {
+			logger.WithError(err).Error("Failed to get unmapped IDs")
+			helper.E(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(rows); err != nil {
+			logger.WithError(err).Error("Failed to encode response")
+			helper.E(w, http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/helper"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/gorilla/mux"
+)
+
+type CoachLuckResponse struct {
+	Coach   string
+	Overall parser.Luck
+	Matches []database.MatchLuck
+}
+
+func CoachLuckHandler(db database.DB) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		coach := vars["name"]
+
+		matches, err := db.GetCoachLuck(coach)
+		if err != nil {
+			logger.WithError(err).WithField("coach", coach).Error("Failed to get coach luck")
+			helper.E(w, http.StatusInternalServerError)
+			return
+		}
+
+		response := CoachLuckResponse{
+			Coach:   coach,
+			Matches: matches,
+		}
+		for _, match := range matches {
+			response.Overall.Merge(match.Luck)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(response); err != nil {
+			logger.WithError(err).Error("Failed to encode response")
+			helper.E(w, http.StatusInternalServerError)
+			return
+		}
+	}
+}
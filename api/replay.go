@@ -2,12 +2,19 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/gobbler-inc/gobblerd/database"
 	"github.com/gobbler-inc/gobblerd/helper"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/gobbler-inc/gobblerd/storage"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+
+	log "github.com/sirupsen/logrus"
 )
 
 func ReplayListHandler(db database.DB) func(w http.ResponseWriter, r *http.Request) {
@@ -37,11 +44,15 @@ func ReplayHandler(db database.DB) func(w http.ResponseWriter, r *http.Request)
 		id, err := uuid.Parse(vars["id"])
 		if err != nil {
 			logger.WithError(err).WithField("id", vars["id"]).Error("Failed to parse replay ID")
-			helper.E(w, http.StatusInternalServerError)
+			helper.E(w, http.StatusBadRequest)
 			return
 		}
 
 		replay, err := db.GetReplay(id)
+		if errors.Is(err, database.ErrNotFound) {
+			helper.E(w, http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			logger.WithError(err).WithField("id", id).Error("Failed to get replay")
 			helper.E(w, http.StatusInternalServerError)
@@ -58,3 +69,112 @@ func ReplayHandler(db database.DB) func(w http.ResponseWriter, r *http.Request)
 		}
 	}
 }
+
+func DrivesHandler(db database.DB) func(w http.ResponseWriter, r *http.Request) {
+	return timelineHandler(db, func(events []parser.Event) interface{} {
+		return parser.Drives(events)
+	})
+}
+
+func TurnsHandler(db database.DB) func(w http.ResponseWriter, r *http.Request) {
+	return timelineHandler(db, func(events []parser.Event) interface{} {
+		return parser.Turns(events)
+	})
+}
+
+// timelineHandler serves a view of a replay that's derived from its timeline
+func timelineHandler(db database.DB, view func(events []parser.Event) interface{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		id, err := uuid.Parse(vars["id"])
+		if err != nil {
+			logger.WithError(err).WithField("id", vars["id"]).Error("Failed to parse replay ID")
+			helper.E(w, http.StatusBadRequest)
+			return
+		}
+
+		replay, err := db.GetReplay(id)
+		if errors.Is(err, database.ErrNotFound) {
+			helper.E(w, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.WithError(err).WithField("id", id).Error("Failed to get replay")
+			helper.E(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(view(replay.Timeline)); err != nil {
+			logger.WithError(err).Error("Failed to encode response")
+			helper.E(w, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// originalExtensions are the file extensions of the formats the originals are downloaded as
+var originalExtensions = map[string]string{
+	"bbrz": ".bbrz",
+	"xml":  ".xml",
+	"gzip": ".xml.gz",
+	"tar":  ".tar",
+}
+
+// OriginalHandler sends back the file the replay was parsed from
+func OriginalHandler(db database.DB, blobs storage.BlobStore) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		id, err := uuid.Parse(vars["id"])
+		if err != nil {
+			logger.WithError(err).WithField("id", vars["id"]).Error("Failed to parse replay ID")
+			helper.E(w, http.StatusBadRequest)
+			return
+		}
+
+		replay, err := db.GetReplay(id)
+		if errors.Is(err, database.ErrNotFound) {
+			helper.E(w, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.WithError(err).WithField("id", id).Error("Failed to get replay")
+			helper.E(w, http.StatusInternalServerError)
+			return
+		}
+
+		// Replays stored before the blob store existed have no original
+		if replay.Original == "" {
+			helper.E(w, http.StatusNotFound)
+			return
+		}
+
+		blob, err := blobs.Get(replay.Original)
+		if errors.Is(err, storage.ErrNotFound) {
+			logger.WithFields(log.Fields{
+				"id":  id,
+				"key": replay.Original,
+			}).Warn("Original of replay is missing from the blob store")
+			helper.E(w, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.WithError(err).WithField("id", id).Error("Failed to get original")
+			helper.E(w, http.StatusInternalServerError)
+			return
+		}
+		defer blob.Close()
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s%s\"", id.String(), originalExtensions[replay.Format]))
+		w.Header().Set("ETag", fmt.Sprintf("\"%s\"", replay.Original))
+
+		if _, err := io.Copy(w, blob); err != nil {
+			logger.WithError(err).WithField("id", id).Error("Failed to send original")
+		}
+	}
+}
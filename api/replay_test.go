@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// replayDB serves the replays it's given, everything else of database.DB is left unimplemented
+type replayDB struct {
+	database.DB
+	replays map[uuid.UUID]parser.Record
+	err     error
+}
+
+func (db replayDB) GetReplay(id uuid.UUID) (parser.Record, error) {
+	if db.err != nil {
+		return parser.Record{}, db.err
+	}
+	record, ok := db.replays[id]
+	if !ok {
+		return parser.Record{}, database.ErrNotFound
+	}
+	return record, nil
+}
+
+func TestReplayHandlers(t *testing.T) {
+	id := uuid.New()
+	record := parser.Record{
+		ID: id,
+		Timeline: []parser.Event{
+			{Step: 1, Kind: parser.EventKickOff, Side: parser.SideAway},
+			{Step: 2, Kind: parser.EventAction, Side: parser.SideHome, Turn: 1},
+			{Step: 2, Kind: parser.EventEndTurn, Side: parser.SideHome, Turn: 1},
+		},
+	}
+	db := replayDB{replays: map[uuid.UUID]parser.Record{id: record}}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/replays/{id}", ReplayHandler(db))
+	r.HandleFunc("/api/replays/{id}/drives", DrivesHandler(db))
+	r.HandleFunc("/api/replays/{id}/turns", TurnsHandler(db))
+
+	broken := mux.NewRouter()
+	broken.HandleFunc("/api/replays/{id}", ReplayHandler(replayDB{err: errors.New("connection refused")}))
+	broken.HandleFunc("/api/replays/{id}/drives", DrivesHandler(replayDB{err: errors.New("connection refused")}))
+
+	tests := []struct {
+		name   string
+		router *mux.Router
+		path   string
+		status int
+		items  int
+	}{
+		{"replay", r, "/api/replays/" + id.String(), http.StatusOK, -1},
+		{"drives", r, "/api/replays/" + id.String() + "/drives", http.StatusOK, 1},
+		{"turns", r, "/api/replays/" + id.String() + "/turns", http.StatusOK, 1},
+		{"missing replay", r, "/api/replays/" + uuid.NewString(), http.StatusNotFound, -1},
+		{"drives of a missing replay", r, "/api/replays/" + uuid.NewString() + "/drives", http.StatusNotFound, -1},
+		{"turns of a missing replay", r, "/api/replays/" + uuid.NewString() + "/turns", http.StatusNotFound, -1},
+		{"invalid ID", r, "/api/replays/nope/turns", http.StatusBadRequest, -1},
+		{"invalid replay ID", r, "/api/replays/nope", http.StatusBadRequest, -1},
+		{"database error", broken, "/api/replays/" + id.String(), http.StatusInternalServerError, -1},
+		{"database error for drives", broken, "/api/replays/" + id.String() + "/drives", http.StatusInternalServerError, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("GET %s = %d, want %d", tt.path, w.Code, tt.status)
+			}
+			if tt.items < 0 {
+				return
+			}
+			var items []json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(items) != tt.items {
+				t.Errorf("GET %s returned %d items, want %d", tt.path, len(items), tt.items)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/helper"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func SeriesHandler(db database.DB) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		id, err := uuid.Parse(vars["id"])
+		if err != nil {
+			logger.WithError(err).WithField("id", vars["id"]).Error("Failed to parse series ID")
+			helper.E(w, http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.GetSeries(id)
+		if err != nil {
+			logger.WithError(err).WithField("id", id).Error("Failed to get series")
+			helper.E(w, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(rows); err != nil {
+			logger.WithError(err).Error("Failed to encode response")
+			helper.E(w, http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -2,21 +2,30 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gobbler-inc/gobblerd/api"
 	"github.com/gobbler-inc/gobblerd/config"
+	"github.com/gobbler-inc/gobblerd/database"
 	"github.com/gobbler-inc/gobblerd/database/cockroach"
 	"github.com/gobbler-inc/gobblerd/helper"
 	"github.com/gobbler-inc/gobblerd/logging"
+	"github.com/gobbler-inc/gobblerd/parser"
 	"github.com/gobbler-inc/gobblerd/processor"
+	"github.com/gobbler-inc/gobblerd/storage"
+	"github.com/gobbler-inc/gobblerd/storage/local"
+	"github.com/gobbler-inc/gobblerd/storage/s3"
 	"github.com/gobbler-inc/gobblerd/ui"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
 	log "github.com/sirupsen/logrus"
@@ -24,10 +33,12 @@ import (
 
 var (
 	configPath string = "/etc/gobblerd/config.yml"
+	reprocess  string
 )
 
 func main() {
 	flag.StringVar(&configPath, "cfg", "/etc/gobblerd/config.yml", "Path to the config file")
+	flag.StringVar(&reprocess, "reprocess", "", "Reprocess stored replays and exit: all, outdated or a comma separated list of replay IDs")
 	flag.Parse()
 
 	if err := config.Load(configPath); err != nil {
@@ -64,23 +75,85 @@ func main() {
 	if err != nil {
 		logger.WithError(err).WithField("max_retries", retries).Fatalf("Maximum number of retries reached, giving up.")
 	}
-	defer db.Close(context.Background())
+	defer db.Close()
+
+	blobs, err := newBlobStore(config.Cfg.GetString("storage.kind"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to set up blob storage")
+	}
+
+	if reprocess != "" {
+		if err := runReprocess(db, blobs, reprocess); err != nil {
+			// Fatal exits right away, the deferred Close wouldn't run
+			db.Close()
+			logger.WithError(err).Fatal("Failed to reprocess replays")
+		}
+		return
+	}
+
+	mappingsDone := make(chan struct{})
+	parser.WatchMappings(mappingsDone)
 
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
-	reg := processor.NewRegistry(db, wg)
+	reg := processor.NewRegistry(db, blobs, wg)
 
 	r := mux.NewRouter()
 
 	r.HandleFunc("/upload", reg.HandleProcessRequest).Methods(http.MethodPost)
 	r.HandleFunc("/upload", helper.CorsHandler).Methods(http.MethodOptions)
 
+	r.HandleFunc("/api/tasks", reg.HandleTaskList).Methods(http.MethodGet)
+	r.HandleFunc("/api/tasks", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/tasks/events", reg.HandleTaskEvents).Methods(http.MethodGet)
+	r.HandleFunc("/api/tasks/events", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/tasks/{id}", reg.HandleTask).Methods(http.MethodGet)
+	r.HandleFunc("/api/tasks/{id}", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/batches/{id}", reg.HandleBatch).Methods(http.MethodGet)
+	r.HandleFunc("/api/batches/{id}", helper.CorsHandler).Methods(http.MethodOptions)
+
 	r.HandleFunc("/api/replays", api.ReplayListHandler(db)).Methods(http.MethodGet)
 	r.HandleFunc("/api/replays", helper.CorsHandler).Methods(http.MethodOptions)
 
 	r.HandleFunc("/api/replays/{id}", api.ReplayHandler(db)).Methods(http.MethodGet)
 	r.HandleFunc("/api/replays/{id}", helper.CorsHandler).Methods(http.MethodOptions)
 
+	r.HandleFunc("/api/replays/{id}/drives", api.DrivesHandler(db)).Methods(http.MethodGet)
+	r.HandleFunc("/api/replays/{id}/drives", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/replays/{id}/turns", api.TurnsHandler(db)).Methods(http.MethodGet)
+	r.HandleFunc("/api/replays/{id}/turns", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/replays/{id}/original", api.OriginalHandler(db, blobs)).Methods(http.MethodGet)
+	r.HandleFunc("/api/replays/{id}/original", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/series/{id}", api.SeriesHandler(db)).Methods(http.MethodGet)
+	r.HandleFunc("/api/series/{id}", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/coaches/{name}/luck", api.CoachLuckHandler(db)).Methods(http.MethodGet)
+	r.HandleFunc("/api/coaches/{name}/luck", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/admin/unmapped", api.UnmappedIDsHandler(db)).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/unmapped", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/admin/dead-letters", reg.HandleDeadLetterList).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/dead-letters", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/admin/dead-letters/{id}", reg.HandleDeadLetterDiscard).Methods(http.MethodDelete)
+	r.HandleFunc("/api/admin/dead-letters/{id}", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/admin/dead-letters/{id}/retry", reg.HandleDeadLetterRetry).Methods(http.MethodPost)
+	r.HandleFunc("/api/admin/dead-letters/{id}/retry", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.HandleFunc("/api/admin/reprocess", reg.HandleReprocessStatus).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/reprocess", reg.HandleReprocess).Methods(http.MethodPost)
+	r.HandleFunc("/api/admin/reprocess", helper.CorsHandler).Methods(http.MethodOptions)
+
+	r.Handle("/debug/vars", expvar.Handler()).Methods(http.MethodGet)
+
 	spaHandler := ui.NewSpaHandler()
 	r.PathPrefix("/").Handler(spaHandler)
 
@@ -106,5 +179,60 @@ func main() {
 	logger.Debug("Received stop signal")
 	s.Shutdown(context.Background())
 	reg.Stop()
+	close(mappingsDone)
 	wg.Wait()
 }
+
+func newBlobStore(kind string) (storage.BlobStore, error) {
+	switch kind {
+	case "s3":
+		return s3.New()
+	case "", "local":
+		return local.New()
+	}
+	return nil, fmt.Errorf("Unknown storage kind %s", kind)
+}
+
+// runReprocess runs a reprocessing job in the foreground, an interrupt stops it
+// after the current replay. It fails if any of the replays couldn't be reprocessed.
+func runReprocess(db database.DB, blobs storage.BlobStore, target string) error {
+	logger := logging.NewLogger("main")
+
+	if err := parser.ReloadMappings(); err != nil {
+		return fmt.Errorf("Failed to load mappings: %w", err)
+	}
+
+	filter := database.ReplayFilter{}
+	switch target {
+	case "all":
+	case "outdated":
+		filter.BelowVersion = parser.Version
+		filter.BelowMappingVersion = parser.MappingsVersion()
+	default:
+		for _, value := range strings.Split(target, ",") {
+			id, err := uuid.Parse(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("Invalid replay ID %s: %w", value, err)
+			}
+			filter.IDs = append(filter.IDs, id)
+		}
+	}
+
+	stop := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	go func() {
+		<-sigChan
+		logger.Info("Received stop signal, stopping after the current replay")
+		close(stop)
+	}()
+
+	job, err := processor.NewReprocessor(db, blobs).Run(filter, stop)
+	if err != nil {
+		return err
+	}
+	if job.Failed > 0 {
+		return fmt.Errorf("%d of %d replays couldn't be reprocessed", job.Failed, job.Total)
+	}
+	return nil
+}
@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/alfreddobradi/goconf"
 	"github.com/gobbler-inc/gobblerd/database/cockroach"
 	"github.com/gobbler-inc/gobblerd/logging"
+	"github.com/gobbler-inc/gobblerd/parser"
 	"github.com/gobbler-inc/gobblerd/processor"
+	"github.com/gobbler-inc/gobblerd/storage/local"
+	"github.com/gobbler-inc/gobblerd/storage/s3"
 )
 
 var Cfg *goconf.Configuration
@@ -18,6 +22,36 @@ func Load(path string) error {
 	grammar := struct {
 		Runner struct {
 			TaskInterval string `yaml:"task_interval" env:"GOBBLER_RUNNER_TASK_INTERVAL"`
+			SpoolPath    string `yaml:"spool_path" env:"GOBBLER_RUNNER_SPOOL_PATH"`
+			Workers      int    `env:"GOBBLER_RUNNER_WORKERS"`
+			QueueSize    int    `yaml:"queue_size" env:"GOBBLER_RUNNER_QUEUE_SIZE"`
+			Watch        struct {
+				Paths    string `env:"GOBBLER_RUNNER_WATCH_PATHS"`
+				Interval string `env:"GOBBLER_RUNNER_WATCH_INTERVAL"`
+			}
+			Retry struct {
+				File struct {
+					MaxAttempts int    `yaml:"max_attempts" env:"GOBBLER_RUNNER_RETRY_FILE_MAX_ATTEMPTS"`
+					BaseDelay   string `yaml:"base_delay" env:"GOBBLER_RUNNER_RETRY_FILE_BASE_DELAY"`
+					MaxDelay    string `yaml:"max_delay" env:"GOBBLER_RUNNER_RETRY_FILE_MAX_DELAY"`
+				}
+				Database struct {
+					MaxAttempts int    `yaml:"max_attempts" env:"GOBBLER_RUNNER_RETRY_DATABASE_MAX_ATTEMPTS"`
+					BaseDelay   string `yaml:"base_delay" env:"GOBBLER_RUNNER_RETRY_DATABASE_BASE_DELAY"`
+					MaxDelay    string `yaml:"max_delay" env:"GOBBLER_RUNNER_RETRY_DATABASE_MAX_DELAY"`
+				}
+				Storage struct {
+					MaxAttempts int    `yaml:"max_attempts" env:"GOBBLER_RUNNER_RETRY_STORAGE_MAX_ATTEMPTS"`
+					BaseDelay   string `yaml:"base_delay" env:"GOBBLER_RUNNER_RETRY_STORAGE_BASE_DELAY"`
+					MaxDelay    string `yaml:"max_delay" env:"GOBBLER_RUNNER_RETRY_STORAGE_MAX_DELAY"`
+				}
+			}
+		}
+		Parser struct {
+			Mappings struct {
+				Path           string `env:"GOBBLER_PARSER_MAPPINGS_PATH"`
+				ReloadInterval string `yaml:"reload_interval" env:"GOBBLER_PARSER_MAPPINGS_RELOAD_INTERVAL"`
+			}
 		}
 		Logging struct {
 			Format string `env:"GOBBLER_LOGGING_FORMAT"`
@@ -38,6 +72,20 @@ func Load(path string) error {
 				SSLRootCert string `yaml:"ssl_root_cert" env:"GOBBLER_DB_SSL_ROOT_CERT"`
 			} `yaml:"crdb"`
 		}
+		Storage struct {
+			Kind  string `env:"GOBBLER_STORAGE_KIND"`
+			Local struct {
+				Path string `env:"GOBBLER_STORAGE_LOCAL_PATH"`
+			}
+			S3 struct {
+				Endpoint  string `env:"GOBBLER_STORAGE_S3_ENDPOINT"`
+				Bucket    string `env:"GOBBLER_STORAGE_S3_BUCKET"`
+				Region    string `env:"GOBBLER_STORAGE_S3_REGION"`
+				AccessKey string `yaml:"access_key" env:"GOBBLER_STORAGE_S3_ACCESS_KEY"`
+				SecretKey string `yaml:"secret_key" env:"GOBBLER_STORAGE_S3_SECRET_KEY"`
+				UseSSL    bool   `yaml:"use_ssl" env:"GOBBLER_STORAGE_S3_USE_SSL"`
+			} `yaml:"s3"`
+		}
 	}{}
 
 	fp, err := os.OpenFile(path, os.O_RDONLY, 0755)
@@ -57,10 +105,23 @@ func Load(path string) error {
 
 	SetRunnerConfig(config)
 
+	SetRetryConfig(config)
+
+	SetWatchConfig(config)
+
+	SetParserConfig(config)
+
 	if config.GetString("database.kind") == "crdb" {
 		SetCockroachConfig(config)
 	}
 
+	switch config.GetString("storage.kind") {
+	case "s3":
+		SetS3Config(config)
+	default:
+		SetLocalStorageConfig(config)
+	}
+
 	return nil
 }
 
@@ -98,6 +159,38 @@ func SetCockroachConfig(config *goconf.Configuration) {
 	}
 }
 
+func SetLocalStorageConfig(config *goconf.Configuration) {
+	if path := config.GetString("storage.local.path"); path != "" && path != local.Path() {
+		local.SetPath(path)
+	}
+}
+
+func SetS3Config(config *goconf.Configuration) {
+	if endpoint := config.GetString("storage.s3.endpoint"); endpoint != "" && endpoint != s3.Endpoint() {
+		s3.SetEndpoint(endpoint)
+	}
+
+	if bucket := config.GetString("storage.s3.bucket"); bucket != "" && bucket != s3.Bucket() {
+		s3.SetBucket(bucket)
+	}
+
+	if region := config.GetString("storage.s3.region"); region != "" && region != s3.Region() {
+		s3.SetRegion(region)
+	}
+
+	if accessKey := config.GetString("storage.s3.access_key"); accessKey != "" && accessKey != s3.AccessKey() {
+		s3.SetAccessKey(accessKey)
+	}
+
+	if secretKey := config.GetString("storage.s3.secret_key"); secretKey != "" && secretKey != s3.SecretKey() {
+		s3.SetSecretKey(secretKey)
+	}
+
+	if useSSL := config.GetBool("storage.s3.use_ssl"); useSSL != s3.UseSSL() {
+		s3.SetUseSSL(useSSL)
+	}
+}
+
 func SetLoggingConfig(config *goconf.Configuration) {
 	if format := config.GetString("logging.format"); format != logging.Format() {
 		logging.SetFormat(format)
@@ -117,6 +210,18 @@ func SetLoggingConfig(config *goconf.Configuration) {
 }
 
 func SetRunnerConfig(config *goconf.Configuration) {
+	if spoolPath := config.GetString("runner.spool_path"); spoolPath != "" && spoolPath != processor.SpoolPath() {
+		processor.SetSpoolPath(spoolPath)
+	}
+
+	if workers := config.GetInt("runner.workers"); workers > 0 && workers != processor.Workers() {
+		processor.SetWorkers(workers)
+	}
+
+	if queueSize := config.GetInt("runner.queue_size"); queueSize > 0 && queueSize != processor.QueueSize() {
+		processor.SetQueueSize(queueSize)
+	}
+
 	taskInterval := config.GetString("runner.task_interval")
 	interval, err := time.ParseDuration(taskInterval)
 	if err != nil {
@@ -125,3 +230,80 @@ func SetRunnerConfig(config *goconf.Configuration) {
 	}
 	processor.SetTaskInterval(interval)
 }
+
+// SetRetryConfig overrides the retry policies of the error classes that are worth retrying
+func SetRetryConfig(config *goconf.Configuration) {
+	classes := map[string]processor.ErrorClass{
+		"file":     processor.ClassFile,
+		"database": processor.ClassDatabase,
+		"storage":  processor.ClassStorage,
+	}
+
+	for key, class := range classes {
+		policy := processor.RetryPolicyFor(class)
+		prefix := fmt.Sprintf("runner.retry.%s", key)
+
+		if maxAttempts := config.GetInt(prefix + ".max_attempts"); maxAttempts > 0 {
+			policy.MaxAttempts = maxAttempts
+		}
+
+		if baseDelay := config.GetString(prefix + ".base_delay"); baseDelay != "" {
+			delay, err := time.ParseDuration(baseDelay)
+			if err != nil {
+				log.Printf("Invalid delay %s. Using default %s.", baseDelay, policy.BaseDelay)
+			} else {
+				policy.BaseDelay = delay
+			}
+		}
+
+		if maxDelay := config.GetString(prefix + ".max_delay"); maxDelay != "" {
+			delay, err := time.ParseDuration(maxDelay)
+			if err != nil {
+				log.Printf("Invalid delay %s. Using default %s.", maxDelay, policy.MaxDelay)
+			} else {
+				policy.MaxDelay = delay
+			}
+		}
+
+		processor.SetRetryPolicy(class, policy)
+	}
+}
+
+// SetWatchConfig sets up the drop folders, runner.watch.paths is a comma separated list
+func SetWatchConfig(config *goconf.Configuration) {
+	paths := make([]string, 0)
+	for _, path := range strings.Split(config.GetString("runner.watch.paths"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	processor.SetWatchPaths(paths)
+
+	watchInterval := config.GetString("runner.watch.interval")
+	if watchInterval == "" {
+		return
+	}
+	interval, err := time.ParseDuration(watchInterval)
+	if err != nil {
+		log.Printf("Invalid interval %s. Using default %s.", watchInterval, processor.WatchInterval())
+		return
+	}
+	processor.SetWatchInterval(interval)
+}
+
+func SetParserConfig(config *goconf.Configuration) {
+	if path := config.GetString("parser.mappings.path"); path != parser.MappingPath() {
+		parser.SetMappingPath(path)
+	}
+
+	reloadInterval := config.GetString("parser.mappings.reload_interval")
+	if reloadInterval == "" {
+		return
+	}
+	interval, err := time.ParseDuration(reloadInterval)
+	if err != nil {
+		log.Printf("Invalid interval %s. Using default %s.", reloadInterval, parser.MappingReloadInterval())
+		return
+	}
+	parser.SetMappingReloadInterval(interval)
+}
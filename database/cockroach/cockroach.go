@@ -3,82 +3,238 @@ package cockroach
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/gobbler-inc/gobblerd/database"
 	"github.com/gobbler-inc/gobblerd/parser"
 	"github.com/google/uuid"
 
 	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
 	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+// DB is backed by a connection pool since the HTTP handlers and the
+// processor's workers use it at the same time
 type DB struct {
-	*pgx.Conn
+	*pgxpool.Pool
 }
 
 func New() (*DB, error) {
 	logger.WithField("host", Host()).Info("Connecting to CockroachDB")
 	connUrl := createConnUrl()
 
-	config, err := pgx.ParseConfig(connUrl)
+	config, err := pgxpool.ParseConfig(connUrl)
 	if err != nil {
 		return nil, fmt.Errorf("Error parsing connection url: %v", err)
 	}
-	config.RuntimeParams["application_name"] = "$ gobb"
-	conn, err := pgx.ConnectConfig(context.Background(), config)
+	config.ConnConfig.RuntimeParams["application_name"] = "$ gobb"
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
 	if err != nil {
 		return nil, fmt.Errorf("Error connecting to cluster: %v", err)
 	}
 
 	logger.WithField("host", Host()).Info("Connected to CockroachDB")
 
-	return &DB{conn}, nil
+	return &DB{pool}, nil
 }
 
-func (db *DB) SaveReplay(record parser.Record) error {
+// replayColumns are written by SaveReplay and UpdateReplay in the order replayArgs returns them
+const replayColumns = "id, series_id, match_id, content_hash, original_key, format, format_version, parser_version, mapping_version, partial, partial_reason, match_info, home_team, away_team, timeline, dice, unmapped"
+
+func replayArgs(record parser.Record) ([]interface{}, error) {
 	homeJson, err := json.Marshal(record.Home)
 	if err != nil {
-		return fmt.Errorf("Failed to marshal home team data: %v", err)
+		return nil, fmt.Errorf("Failed to marshal home team data: %v", err)
 	}
 	awayJson, err := json.Marshal(record.Away)
 	if err != nil {
-		return fmt.Errorf("Failed to marshal away team data: %v", err)
+		return nil, fmt.Errorf("Failed to marshal away team data: %v", err)
+	}
+	matchJson, err := json.Marshal(record.Match)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal match info: %v", err)
+	}
+	timelineJson, err := json.Marshal(record.Timeline)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal timeline: %v", err)
+	}
+	diceJson, err := json.Marshal(record.Rolls)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal dice rolls: %v", err)
+	}
+	unmappedJson, err := json.Marshal(record.Unmapped)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal unmapped IDs: %v", err)
+	}
+
+	return []interface{}{record.ID.String(), record.SeriesID.String(), record.MatchID, record.ContentHash, record.Original, record.Format, record.FormatVersion, record.ParserVersion, record.MappingVersion, record.Partial, record.PartialReason, string(matchJson), string(homeJson), string(awayJson), string(timelineJson), string(diceJson), string(unmappedJson)}, nil
+}
+
+// placeholders returns $from, $from+1, ... for n arguments
+func placeholders(from, n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = fmt.Sprintf("$%d", from+i)
+	}
+	return strings.Join(list, ", ")
+}
+
+func (db *DB) SaveReplay(record parser.Record) error {
+	args, err := replayArgs(record)
+	if err != nil {
+		return err
+	}
+
+	txErr := crdbpgx.ExecuteTx(context.Background(), db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		_, err := tx.Exec(context.Background(), fmt.Sprintf("INSERT INTO replays (%s) VALUES (%s)", replayColumns, placeholders(1, len(args))), args...)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+
+	if txErr != nil {
+		return fmt.Errorf("Error executing statement: %w", txErr)
+	}
+
+	return nil
+}
+
+// UpdateReplay replaces everything derived from the original file of a stored
+// replay, the ID and the upload time stay the same
+func (db *DB) UpdateReplay(record parser.Record) error {
+	args, err := replayArgs(record)
+	if err != nil {
+		return err
 	}
 
+	// The ID is the first column, it's only used to find the row
+	columns := strings.TrimPrefix(replayColumns, "id, ")
+	query := fmt.Sprintf("UPDATE replays SET (%s) = (%s) WHERE id = $1", columns, placeholders(2, len(args)-1))
+
 	txErr := crdbpgx.ExecuteTx(context.Background(), db, pgx.TxOptions{}, func(tx pgx.Tx) error {
-		_, err := tx.Exec(context.Background(), `INSERT INTO replays (id, home_team, away_team) VALUES ($1, $2, $3)`, record.ID.String(), string(homeJson), string(awayJson))
+		tag, err := tx.Exec(context.Background(), query, args...)
 		if err != nil {
 			return err
 		}
+		if tag.RowsAffected() == 0 {
+			return database.ErrNotFound
+		}
 		return nil
 	})
 
 	if txErr != nil {
-		return fmt.Errorf("Error executing statement: %v", err)
+		return fmt.Errorf("Error executing statement: %w", txErr)
 	}
 
 	return nil
 }
 
+// GetOriginals returns the blob keys of the replays matching the filter, oldest
+// upload first. Replays stored before their originals were kept are left out.
+func (db *DB) GetOriginals(filter database.ReplayFilter) ([]database.Original, error) {
+	conditions := []string{"original_key != ''"}
+	args := make([]interface{}, 0)
+	if len(filter.IDs) > 0 {
+		ids := make([]string, 0, len(filter.IDs))
+		for _, id := range filter.IDs {
+			ids = append(ids, id.String())
+		}
+		args = append(args, ids)
+		conditions = append(conditions, fmt.Sprintf("id = ANY($%d::UUID[])", len(args)))
+	}
+	if filter.SeriesID != uuid.Nil {
+		args = append(args, filter.SeriesID)
+		conditions = append(conditions, fmt.Sprintf("series_id = $%d", len(args)))
+	}
+	outdated := make([]string, 0)
+	if filter.BelowVersion > 0 {
+		args = append(args, filter.BelowVersion)
+		outdated = append(outdated, fmt.Sprintf("parser_version < $%d", len(args)))
+	}
+	if filter.BelowMappingVersion > 0 {
+		args = append(args, filter.BelowMappingVersion)
+		outdated = append(outdated, fmt.Sprintf("mapping_version < $%d", len(args)))
+	}
+	if len(outdated) > 0 {
+		conditions = append(conditions, fmt.Sprintf("(%s)", strings.Join(outdated, " OR ")))
+	}
+
+	rows, err := db.Query(context.Background(), fmt.Sprintf("SELECT id, original_key FROM replays WHERE %s ORDER BY uploaded_at", strings.Join(conditions, " AND ")), args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve rows: %w", err)
+	}
+	defer rows.Close()
+
+	response := make([]database.Original, 0)
+	for rows.Next() {
+		var original database.Original
+		if err := rows.Scan(&original.ReplayID, &original.Key); err != nil {
+			return nil, fmt.Errorf("Failed to scan row into struct: %w", err)
+		}
+		response = append(response, original)
+	}
+
+	return response, rows.Err()
+}
+
+// summaryColumns are the columns needed for the lists of replays, the
+// heavier per-match data is only loaded by GetReplay
+const summaryColumns = "id, series_id, match_id, content_hash, original_key, format, format_version, parser_version, mapping_version, partial, partial_reason, match_info, home_team, away_team"
+
 func (db *DB) GetReplayList() ([]parser.Record, error) {
-	rows, err := db.Query(context.Background(), "SELECT * FROM replays")
+	rows, err := db.Query(context.Background(), fmt.Sprintf("SELECT %s FROM replays", summaryColumns))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to retrieve rows: %w", err)
 	}
-	response := make([]parser.Record, 0)
 	defer rows.Close()
+
+	return scanSummaries(rows)
+}
+
+func (db *DB) GetSeries(seriesID uuid.UUID) ([]parser.Record, error) {
+	rows, err := db.Query(context.Background(), fmt.Sprintf("SELECT %s FROM replays WHERE series_id = $1 ORDER BY uploaded_at", summaryColumns), seriesID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve rows: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSummaries(rows)
+}
+
+func scanSummaries(rows pgx.Rows) ([]parser.Record, error) {
+	response := make([]parser.Record, 0)
 	for rows.Next() {
 		var id uuid.UUID
+		var seriesID uuid.UUID
+		var matchID string
+		var contentHash string
+		var original string
+		var format string
+		var formatVersion string
+		var parserVersion int
+		var mappingVersion int
+		var partial bool
+		var partialReason string
+		var match string
 		var home string
 		var away string
-		if err := rows.Scan(&id, &home, &away); err != nil {
+		if err := rows.Scan(&id, &seriesID, &matchID, &contentHash, &original, &format, &formatVersion, &parserVersion, &mappingVersion, &partial, &partialReason, &match, &home, &away); err != nil {
 			return nil, fmt.Errorf("Failed to scan row into struct: %w", err)
 		}
 
+		var matchStruct parser.MatchInfo
 		var homeStruct parser.TeamStats
 		var awayStruct parser.TeamStats
 
+		if err := json.Unmarshal([]byte(match), &matchStruct); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal match info in replay %s: %w", id.String(), err)
+		}
+
 		if err := json.Unmarshal([]byte(home), &homeStruct); err != nil {
 			return nil, fmt.Errorf("Failed to unmarshal home team data in replay %s: %w", id.String(), err)
 		}
@@ -88,9 +244,20 @@ func (db *DB) GetReplayList() ([]parser.Record, error) {
 		}
 
 		response = append(response, parser.Record{
-			ID:   id,
-			Home: homeStruct,
-			Away: awayStruct,
+			ID:             id,
+			SeriesID:       seriesID,
+			MatchID:        matchID,
+			ContentHash:    contentHash,
+			Original:       original,
+			Format:         format,
+			FormatVersion:  formatVersion,
+			ParserVersion:  parserVersion,
+			MappingVersion: mappingVersion,
+			Partial:        partial,
+			PartialReason:  partialReason,
+			Match:          matchStruct,
+			Home:           homeStruct,
+			Away:           awayStruct,
 		})
 	}
 
@@ -98,7 +265,7 @@ func (db *DB) GetReplayList() ([]parser.Record, error) {
 }
 
 func (db *DB) GetReplay(id uuid.UUID) (parser.Record, error) {
-	rows, err := db.Query(context.Background(), "SELECT * FROM replays WHERE id = $1", id)
+	rows, err := db.Query(context.Background(), "SELECT id, series_id, match_id, content_hash, original_key, format, format_version, parser_version, mapping_version, partial, partial_reason, match_info, home_team, away_team, timeline, dice, unmapped FROM replays WHERE id = $1", id)
 	if err != nil {
 		return parser.Record{}, fmt.Errorf("Failed to retrieve rows: %w", err)
 	}
@@ -106,14 +273,36 @@ func (db *DB) GetReplay(id uuid.UUID) (parser.Record, error) {
 	defer rows.Close()
 	for rows.Next() {
 		var id uuid.UUID
+		var seriesID uuid.UUID
+		var matchID string
+		var contentHash string
+		var original string
+		var format string
+		var formatVersion string
+		var parserVersion int
+		var mappingVersion int
+		var partial bool
+		var partialReason string
+		var match string
 		var home string
 		var away string
-		if err := rows.Scan(&id, &home, &away); err != nil {
+		var timeline string
+		var dice string
+		var unmapped string
+		if err := rows.Scan(&id, &seriesID, &matchID, &contentHash, &original, &format, &formatVersion, &parserVersion, &mappingVersion, &partial, &partialReason, &match, &home, &away, &timeline, &dice, &unmapped); err != nil {
 			return parser.Record{}, fmt.Errorf("Failed to scan row into struct: %w", err)
 		}
 
+		var matchStruct parser.MatchInfo
 		var homeStruct parser.TeamStats
 		var awayStruct parser.TeamStats
+		var timelineSlice []parser.Event
+		var diceSlice []parser.DiceRoll
+		var unmappedSlice []parser.UnmappedID
+
+		if err := json.Unmarshal([]byte(match), &matchStruct); err != nil {
+			return parser.Record{}, fmt.Errorf("Failed to unmarshal match info in replay %s: %w", id.String(), err)
+		}
 
 		if err := json.Unmarshal([]byte(home), &homeStruct); err != nil {
 			return parser.Record{}, fmt.Errorf("Failed to unmarshal home team data in replay %s: %w", id.String(), err)
@@ -123,16 +312,146 @@ func (db *DB) GetReplay(id uuid.UUID) (parser.Record, error) {
 			return parser.Record{}, fmt.Errorf("Failed to unmarshal away team data in replay %s: %w", id.String(), err)
 		}
 
+		if err := json.Unmarshal([]byte(timeline), &timelineSlice); err != nil {
+			return parser.Record{}, fmt.Errorf("Failed to unmarshal timeline in replay %s: %w", id.String(), err)
+		}
+
+		if err := json.Unmarshal([]byte(dice), &diceSlice); err != nil {
+			return parser.Record{}, fmt.Errorf("Failed to unmarshal dice rolls in replay %s: %w", id.String(), err)
+		}
+
+		if err := json.Unmarshal([]byte(unmapped), &unmappedSlice); err != nil {
+			return parser.Record{}, fmt.Errorf("Failed to unmarshal unmapped IDs in replay %s: %w", id.String(), err)
+		}
+
 		response = append(response, parser.Record{
-			ID:   id,
-			Home: homeStruct,
-			Away: awayStruct,
+			ID:             id,
+			SeriesID:       seriesID,
+			MatchID:        matchID,
+			ContentHash:    contentHash,
+			Original:       original,
+			Format:         format,
+			FormatVersion:  formatVersion,
+			ParserVersion:  parserVersion,
+			MappingVersion: mappingVersion,
+			Partial:        partial,
+			PartialReason:  partialReason,
+			Match:          matchStruct,
+			Home:           homeStruct,
+			Away:           awayStruct,
+			Timeline:       timelineSlice,
+			Rolls:          diceSlice,
+			Unmapped:       unmappedSlice,
 		})
 	}
 
+	if len(response) == 0 {
+		return parser.Record{}, database.ErrNotFound
+	}
+
 	return response[0], nil
 }
 
+func (db *DB) GetReplayByOriginal(key string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := db.QueryRow(context.Background(), "SELECT id FROM replays WHERE original_key = $1 LIMIT 1", key).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, database.ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("Failed to retrieve row: %w", err)
+	}
+
+	return id, nil
+}
+
+func (db *DB) GetReplayByContent(record parser.Record) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := db.QueryRow(context.Background(), "SELECT id FROM replays WHERE id = $1 OR (content_hash = $2 AND content_hash != '') LIMIT 1",
+		record.ID, record.ContentHash).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, database.ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("Failed to retrieve row: %w", err)
+	}
+
+	return id, nil
+}
+
+// playedAt is when the match started, replays without a start time count as
+// played when they were uploaded. A zero time.Time is stored for a missing one.
+const playedAt = "COALESCE(NULLIF(match_info->>'Started', '0001-01-01T00:00:00Z')::TIMESTAMPTZ, uploaded_at)"
+
+func (db *DB) GetCoachLuck(coach string) ([]database.MatchLuck, error) {
+	rows, err := db.Query(context.Background(), fmt.Sprintf(`SELECT id, home_team, away_team, uploaded_at, %[1]s FROM replays
+		WHERE home_team->>'CoachName' = $1 OR away_team->>'CoachName' = $1
+		ORDER BY %[1]s, uploaded_at`, playedAt), coach)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve rows: %w", err)
+	}
+	response := make([]database.MatchLuck, 0)
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var home string
+		var away string
+		var uploadedAt time.Time
+		var playedAt time.Time
+		if err := rows.Scan(&id, &home, &away, &uploadedAt, &playedAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan row into struct: %w", err)
+		}
+
+		var homeStruct parser.TeamStats
+		var awayStruct parser.TeamStats
+
+		if err := json.Unmarshal([]byte(home), &homeStruct); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal home team data in replay %s: %w", id.String(), err)
+		}
+
+		if err := json.Unmarshal([]byte(away), &awayStruct); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal away team data in replay %s: %w", id.String(), err)
+		}
+
+		own, opponent := homeStruct, awayStruct
+		if awayStruct.CoachName == coach {
+			own, opponent = awayStruct, homeStruct
+		}
+
+		response = append(response, database.MatchLuck{
+			ReplayID:   id,
+			Team:       own.Name,
+			Opponent:   opponent.Name,
+			UploadedAt: uploadedAt,
+			PlayedAt:   playedAt,
+			Luck:       own.Luck,
+		})
+	}
+
+	return response, nil
+}
+
+func (db *DB) GetUnmappedIDs() ([]database.UnmappedSummary, error) {
+	rows, err := db.Query(context.Background(), `SELECT u->>'Mapping', (u->>'ID')::INT, count(DISTINCT r.id), sum((u->>'Count')::INT)
+		FROM replays AS r, jsonb_array_elements(r.unmapped) AS u
+		GROUP BY 1, 2
+		ORDER BY 1, 2`)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve rows: %w", err)
+	}
+	response := make([]database.UnmappedSummary, 0)
+	defer rows.Close()
+	for rows.Next() {
+		var summary database.UnmappedSummary
+		if err := rows.Scan(&summary.Mapping, &summary.ID, &summary.Replays, &summary.Occurrences); err != nil {
+			return nil, fmt.Errorf("Failed to scan row into struct: %w", err)
+		}
+		response = append(response, summary)
+	}
+
+	return response, nil
+}
+
 func createConnUrl() string {
 	auth := ""
 	if Username() != "" {
@@ -5,7 +5,7 @@ var (
 	port        int    = 26257
 	username    string = ""
 	password    string = ""
-	database    string = "defaultdb"
+	dbName      string = "defaultdb"
 	sslMode     string = "disable"
 	options     string
 	sslRootCert string
@@ -15,7 +15,7 @@ func Host() string        { return host }
 func Port() int           { return port }
 func Username() string    { return username }
 func Password() string    { return password }
-func Database() string    { return database }
+func Database() string    { return dbName }
 func Options() string     { return options }
 func SSLMode() string     { return sslMode }
 func SSLRootCert() string { return sslRootCert }
@@ -24,7 +24,7 @@ func SetHost(newHost string)               { host = newHost }
 func SetPort(newPort int)                  { port = newPort }
 func SetUsername(newUsername string)       { username = newUsername }
 func SetPassword(newPassword string)       { password = newPassword }
-func SetDatabase(newDatabase string)       { database = newDatabase }
+func SetDatabase(newDatabase string)       { dbName = newDatabase }
 func SetOptions(newOptions string)         { options = newOptions }
 func SetSSLMode(newSSLMode string)         { sslMode = newSSLMode }
 func SetSSLRootCert(newSSLRootCert string) { sslRootCert = newSSLRootCert }
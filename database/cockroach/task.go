@@ -0,0 +1,154 @@
+package cockroach
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/google/uuid"
+
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	pgx "github.com/jackc/pgx/v4"
+)
+
+const taskColumns = "id, filename, name, content_key, batch_id, status, error, error_kind, error_class, attempts, next_attempt_at, replay_id, created_at, updated_at"
+
+func (db *DB) CreateTask(task database.Task) error {
+	txErr := crdbpgx.ExecuteTx(context.Background(), db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(context.Background(), `INSERT INTO tasks (id, filename, name, content_key, batch_id, status, error, error_kind, error_class, attempts, next_attempt_at, replay_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`, task.ID, task.Filename, task.Name, task.ContentKey, nullUUID(task.BatchID), task.Status, task.Error, task.ErrorKind, task.Class, task.Attempts, nullTime(task.NextAttempt), nullUUID(task.ReplayID)); err != nil {
+			return err
+		}
+		return insertTransition(tx, task)
+	})
+
+	if txErr != nil {
+		return fmt.Errorf("Error executing statement: %w", txErr)
+	}
+
+	return nil
+}
+
+// UpdateTask stores the new state of the task and records the transition
+func (db *DB) UpdateTask(task database.Task) error {
+	txErr := crdbpgx.ExecuteTx(context.Background(), db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(context.Background(), `UPDATE tasks SET filename = $2, status = $3, error = $4, error_kind = $5, error_class = $6, attempts = $7, next_attempt_at = $8, replay_id = $9, updated_at = now() WHERE id = $1`, task.ID, task.Filename, task.Status, task.Error, task.ErrorKind, task.Class, task.Attempts, nullTime(task.NextAttempt), nullUUID(task.ReplayID))
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return database.ErrNotFound
+		}
+		return insertTransition(tx, task)
+	})
+
+	if txErr != nil {
+		return fmt.Errorf("Error executing statement: %w", txErr)
+	}
+
+	return nil
+}
+
+// nullTime stores a zero time as NULL
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// nullUUID stores uuid.Nil as NULL
+func nullUUID(id uuid.UUID) *string {
+	if id == uuid.Nil {
+		return nil
+	}
+	value := id.String()
+	return &value
+}
+
+func insertTransition(tx pgx.Tx, task database.Task) error {
+	_, err := tx.Exec(context.Background(), `INSERT INTO task_transitions (task_id, status, error, attempt) VALUES ($1, $2, $3, $4)`, task.ID, task.Status, task.Error, task.Attempts)
+	return err
+}
+
+func (db *DB) GetTask(id uuid.UUID) (database.Task, error) {
+	rows, err := db.Query(context.Background(), fmt.Sprintf("SELECT %s FROM tasks WHERE id = $1", taskColumns), id)
+	if err != nil {
+		return database.Task{}, fmt.Errorf("Failed to retrieve rows: %w", err)
+	}
+	defer rows.Close()
+
+	tasks, err := scanTasks(rows)
+	if err != nil {
+		return database.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return database.Task{}, database.ErrNotFound
+	}
+
+	return tasks[0], nil
+}
+
+// GetTasks returns the tasks in any of the given statuses, or every task if there are none, oldest first
+func (db *DB) GetTasks(statuses ...string) ([]database.Task, error) {
+	query := fmt.Sprintf("SELECT %s FROM tasks", taskColumns)
+	args := make([]interface{}, 0)
+	if len(statuses) > 0 {
+		query += " WHERE status = ANY($1)"
+		args = append(args, statuses)
+	}
+	query += " ORDER BY created_at"
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve rows: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTasks(rows)
+}
+
+// GetBatch returns the tasks of a bulk upload in the order they were queued
+func (db *DB) GetBatch(batchID uuid.UUID) ([]database.Task, error) {
+	rows, err := db.Query(context.Background(), fmt.Sprintf("SELECT %s FROM tasks WHERE batch_id = $1 ORDER BY created_at, name", taskColumns), batchID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve rows: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTasks(rows)
+}
+
+func scanTasks(rows pgx.Rows) ([]database.Task, error) {
+	response := make([]database.Task, 0)
+	for rows.Next() {
+		var task database.Task
+		var nextAttempt *time.Time
+		var replayID *string
+		var batchID *string
+		if err := rows.Scan(&task.ID, &task.Filename, &task.Name, &task.ContentKey, &batchID, &task.Status, &task.Error, &task.ErrorKind, &task.Class, &task.Attempts, &nextAttempt, &replayID, &task.CreatedAt, &task.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan row into struct: %w", err)
+		}
+		if nextAttempt != nil {
+			task.NextAttempt = *nextAttempt
+		}
+		if replayID != nil {
+			id, err := uuid.Parse(*replayID)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse replay ID of task %s: %w", task.ID.String(), err)
+			}
+			task.ReplayID = id
+		}
+		if batchID != nil {
+			id, err := uuid.Parse(*batchID)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse batch ID of task %s: %w", task.ID.String(), err)
+			}
+			task.BatchID = id
+		}
+
+		response = append(response, task)
+	}
+
+	return response, rows.Err()
+}
@@ -1,12 +1,92 @@
 package database
 
 import (
+	"errors"
+	"time"
+
 	"github.com/gobbler-inc/gobblerd/parser"
 	"github.com/google/uuid"
 )
 
 type DB interface {
 	SaveReplay(record parser.Record) error
+	UpdateReplay(record parser.Record) error
 	GetReplayList() ([]parser.Record, error)
 	GetReplay(id uuid.UUID) (parser.Record, error)
+	// GetReplayByOriginal finds the replay parsed from the file with the blob key
+	GetReplayByOriginal(key string) (uuid.UUID, error)
+	// GetReplayByContent finds the replay with the ID or content hash of the record,
+	// files that only differ in how they're packed parse to the same
+	GetReplayByContent(record parser.Record) (uuid.UUID, error)
+	GetSeries(seriesID uuid.UUID) ([]parser.Record, error)
+	GetOriginals(filter ReplayFilter) ([]Original, error)
+	GetCoachLuck(coach string) ([]MatchLuck, error)
+	GetUnmappedIDs() ([]UnmappedSummary, error)
+
+	CreateTask(task Task) error
+	UpdateTask(task Task) error
+	GetTask(id uuid.UUID) (Task, error)
+	GetTasks(statuses ...string) ([]Task, error)
+	GetBatch(batchID uuid.UUID) ([]Task, error)
+}
+
+var ErrNotFound = errors.New("Not found")
+
+// ReplayFilter selects stored replays, an empty filter selects every one of them
+type ReplayFilter struct {
+	IDs      []uuid.UUID
+	SeriesID uuid.UUID
+	// BelowVersion selects the replays created by an older parser version if it's set
+	BelowVersion int
+	// BelowMappingVersion selects the replays mapped with older ID mappings if
+	// it's set. Along with BelowVersion a replay matching either one is selected.
+	BelowMappingVersion int
+}
+
+// Original links a stored replay to the blob store key of the file it was parsed from
+type Original struct {
+	ReplayID uuid.UUID
+	Key      string
+}
+
+type MatchLuck struct {
+	ReplayID   uuid.UUID
+	Team       string
+	Opponent   string
+	UploadedAt time.Time
+	// PlayedAt is when the match started or UploadedAt if the replay doesn't say
+	PlayedAt time.Time
+	Luck     parser.Luck
+}
+
+// UnmappedSummary is an unknown game ID aggregated over every stored replay
+type UnmappedSummary struct {
+	Mapping     string
+	ID          int
+	Replays     int
+	Occurrences int
+}
+
+// Task is a processor task as it's persisted. The processor owns what the
+// statuses mean, they're stored in their string form.
+type Task struct {
+	ID       uuid.UUID
+	Filename string
+	// Name is the name the file was uploaded with
+	Name string
+	// ContentKey is the SHA-256 of the file, the key it's kept under in the blob store
+	ContentKey string
+	// BatchID groups the tasks of a bulk upload, uuid.Nil for single uploads
+	BatchID   uuid.UUID
+	Status    string
+	Error     string
+	ErrorKind string
+	Class     string
+	Attempts  int
+	// NextAttempt is when a waiting task is due to be retried, zero for new tasks
+	NextAttempt time.Time
+	// ReplayID is the stored replay once the task succeeded, uuid.Nil until then
+	ReplayID  uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
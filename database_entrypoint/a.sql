@@ -2,7 +2,54 @@ CREATE DATABASE gobb_dev;
 USE gobb_dev;
 
 CREATE TABLE replays (
-	id uuid NOT NULL,
+	id uuid NOT NULL PRIMARY KEY,
+	series_id uuid NOT NULL,
+	match_id string NOT NULL DEFAULT '',
+	content_hash string NOT NULL DEFAULT '',
+	original_key string NOT NULL DEFAULT '',
+	format string NOT NULL DEFAULT '',
+	format_version string NOT NULL DEFAULT '',
+	parser_version int NOT NULL DEFAULT 0,
+	mapping_version int NOT NULL DEFAULT 0,
+	partial bool NOT NULL DEFAULT false,
+	partial_reason string NOT NULL DEFAULT '',
+	match_info jsonb NOT NULL DEFAULT '{}',
 	home_team jsonb NOT NULL,
-	away_team jsonb NOT NULL
+	away_team jsonb NOT NULL,
+	timeline jsonb NOT NULL DEFAULT '[]',
+	dice jsonb NOT NULL DEFAULT '[]',
+	unmapped jsonb NOT NULL DEFAULT '[]',
+	uploaded_at timestamptz NOT NULL DEFAULT now(),
+	INDEX (series_id),
+	INDEX (original_key),
+	INDEX (content_hash)
+);
+
+CREATE TABLE tasks (
+	id uuid NOT NULL PRIMARY KEY,
+	filename string NOT NULL,
+	name string NOT NULL DEFAULT '',
+	content_key string NOT NULL DEFAULT '',
+	batch_id uuid,
+	status string NOT NULL,
+	error string NOT NULL DEFAULT '',
+	error_kind string NOT NULL DEFAULT '',
+	error_class string NOT NULL DEFAULT '',
+	attempts int NOT NULL DEFAULT 0,
+	next_attempt_at timestamptz,
+	replay_id uuid,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	updated_at timestamptz NOT NULL DEFAULT now(),
+	INDEX (status),
+	INDEX (batch_id)
+);
+
+CREATE TABLE task_transitions (
+	id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+	task_id uuid NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+	status string NOT NULL,
+	error string NOT NULL DEFAULT '',
+	attempt int NOT NULL DEFAULT 0,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	INDEX (task_id, created_at)
 );
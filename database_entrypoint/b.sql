@@ -0,0 +1,56 @@
+-- Brings a database created by an older version up to date with a.sql. Every
+-- statement can be run again, on a fresh database it doesn't change anything.
+USE gobb_dev;
+
+-- Replays were stored without a primary key at first
+ALTER TABLE replays ALTER PRIMARY KEY USING COLUMNS (id);
+
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS series_id uuid NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS match_id string NOT NULL DEFAULT '';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS content_hash string NOT NULL DEFAULT '';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS original_key string NOT NULL DEFAULT '';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS format string NOT NULL DEFAULT '';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS format_version string NOT NULL DEFAULT '';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS parser_version int NOT NULL DEFAULT 0;
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS mapping_version int NOT NULL DEFAULT 0;
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS partial bool NOT NULL DEFAULT false;
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS partial_reason string NOT NULL DEFAULT '';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS match_info jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS timeline jsonb NOT NULL DEFAULT '[]';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS dice jsonb NOT NULL DEFAULT '[]';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS unmapped jsonb NOT NULL DEFAULT '[]';
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS uploaded_at timestamptz NOT NULL DEFAULT now();
+CREATE INDEX IF NOT EXISTS replays_series_id_idx ON replays (series_id);
+CREATE INDEX IF NOT EXISTS replays_original_key_idx ON replays (original_key);
+CREATE INDEX IF NOT EXISTS replays_content_hash_idx ON replays (content_hash);
+
+CREATE TABLE IF NOT EXISTS tasks (
+	id uuid NOT NULL PRIMARY KEY,
+	filename string NOT NULL,
+	status string NOT NULL,
+	error string NOT NULL DEFAULT '',
+	error_kind string NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL DEFAULT now(),
+	updated_at timestamptz NOT NULL DEFAULT now(),
+	INDEX (status)
+);
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS name string NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS content_key string NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS batch_id uuid;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS error_class string NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS attempts int NOT NULL DEFAULT 0;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS next_attempt_at timestamptz;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS replay_id uuid;
+CREATE INDEX IF NOT EXISTS tasks_batch_id_idx ON tasks (batch_id);
+
+CREATE TABLE IF NOT EXISTS task_transitions (
+	id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+	task_id uuid NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+	status string NOT NULL,
+	error string NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL DEFAULT now(),
+	INDEX (task_id, created_at)
+);
+
+ALTER TABLE task_transitions ADD COLUMN IF NOT EXISTS attempt int NOT NULL DEFAULT 0;
@@ -0,0 +1,24 @@
+package parser
+
+import "time"
+
+var (
+	mappingPath           string        = ""
+	mappingReloadInterval time.Duration = 30 * time.Second
+)
+
+func MappingPath() string {
+	return mappingPath
+}
+
+func MappingReloadInterval() time.Duration {
+	return mappingReloadInterval
+}
+
+func SetMappingPath(newPath string) {
+	mappingPath = newPath
+}
+
+func SetMappingReloadInterval(newInterval time.Duration) {
+	mappingReloadInterval = newInterval
+}
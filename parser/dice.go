@@ -0,0 +1,247 @@
+package parser
+
+// Raw roll types that count towards the luck index
+const (
+	rollTypeGFI    = 1
+	rollTypeDodge  = 2
+	rollTypePickup = 7
+	rollTypeCatch  = 9
+	rollTypePass   = 12
+)
+
+var luckRollTypes = map[int]bool{
+	rollTypeGFI:    true,
+	rollTypeDodge:  true,
+	rollTypeArmor:  true,
+	rollTypeInjury: true,
+	rollTypeBlock:  true,
+	rollTypePickup: true,
+	rollTypeCatch:  true,
+	rollTypePass:   true,
+}
+
+type Reroll string
+
+const (
+	RerollNone  Reroll = ""
+	RerollTeam  Reroll = "team"
+	RerollSkill Reroll = "skill"
+)
+
+// Raw roll statuses of the replay, everything above rollStatusTeamReroll is
+// a reroll granted by a skill (Dodge, Sure Hands, Pro, etc.)
+const (
+	rollStatusNone       = 0
+	rollStatusTeamReroll = 1
+)
+
+// Raw action types that are made against a player of the other team, an
+// armor or injury roll during one of them is against the target
+const (
+	actionTypeBlock = 1
+	actionTypeBlitz = 2
+	actionTypeFoul  = 5
+	actionTypeStab  = 14
+)
+
+var offensiveActionTypes = map[int]bool{
+	actionTypeBlock: true,
+	actionTypeBlitz: true,
+	actionTypeFoul:  true,
+	actionTypeStab:  true,
+}
+
+// Block dice faces that are considered a good result for the attacker
+const (
+	blockDefenderStumbles = 3
+	blockDefenderDown     = 4
+)
+
+// DiceRoll is a roll that counts towards the luck index. Side is the coach
+// the roll is credited to, which isn't always the one whose player acted.
+type DiceRoll struct {
+	Step        int
+	Side        Side
+	Turn        int
+	PlayerID    int
+	Type        string
+	Dice        []int
+	Requirement int
+	Success     bool
+	Reroll      Reroll
+	Expected    float64
+}
+
+// Luck compares the rolls of a coach to what the dice would give on average.
+// Index is the difference between actual and expected successes per 100 rolls,
+// so 0 is perfectly average, positive is lucky and negative is unlucky.
+type Luck struct {
+	Rolls        int
+	Successes    int
+	Expected     float64
+	TeamRerolls  int
+	SkillRerolls int
+	Index        float64
+}
+
+func (l *Luck) Add(roll DiceRoll) {
+	l.Rolls++
+	if roll.Success {
+		l.Successes++
+	}
+	l.Expected += roll.Expected
+
+	switch roll.Reroll {
+	case RerollTeam:
+		l.TeamRerolls++
+	case RerollSkill:
+		l.SkillRerolls++
+	}
+
+	l.updateIndex()
+}
+
+// Merge adds the rolls of another match to l, used to calculate luck over time
+func (l *Luck) Merge(other Luck) {
+	l.Rolls += other.Rolls
+	l.Successes += other.Successes
+	l.Expected += other.Expected
+	l.TeamRerolls += other.TeamRerolls
+	l.SkillRerolls += other.SkillRerolls
+
+	l.updateIndex()
+}
+
+func (l *Luck) updateIndex() {
+	if l.Rolls == 0 {
+		l.Index = 0
+		return
+	}
+	l.Index = (float64(l.Successes) - l.Expected) / float64(l.Rolls) * 100
+}
+
+func newDiceRoll(idx int, playing Side, playerSide Side, turn int, action RulesEventBoardAction, result BoardActionResult) (DiceRoll, bool) {
+	if !luckRollTypes[result.RollType] {
+		return DiceRoll{}, false
+	}
+
+	roll := DiceRoll{
+		Step:        idx,
+		Side:        playerSide,
+		Turn:        turn,
+		PlayerID:    action.PlayerID,
+		Type:        RollTypeMapping.Name(result.RollType),
+		Dice:        parseDice(result.Dice),
+		Requirement: result.Requirement,
+		Success:     result.ResultType == resultTypePassed,
+	}
+
+	switch result.RollStatus {
+	case rollStatusNone:
+		roll.Reroll = RerollNone
+	case rollStatusTeamReroll:
+		roll.Reroll = RerollTeam
+	default:
+		roll.Reroll = RerollSkill
+	}
+
+	switch result.RollType {
+	case rollTypeBlock:
+		// Against a stronger player the defender picks the die, the attacker
+		// only gets a good result if every die shows one
+		attackerChooses := result.Chooser == nil || sideFromIndex(*result.Chooser) == playerSide
+		roll.Success = blockSuccess(roll.Dice, attackerChooses)
+		roll.Expected = blockProbability(len(roll.Dice), attackerChooses)
+		return roll, true
+	case rollTypeArmor, rollTypeInjury:
+		// A broken armor or an injury is good for the coach of the other team
+		// than the player who's rolled for
+		rolled := playerSide
+		if playerSide == playing && offensiveActionTypes[action.ActionType] {
+			rolled = opponent(playerSide)
+		}
+		roll.Side = opponent(rolled)
+	}
+
+	if len(roll.Dice) == 2 {
+		roll.Expected = twoDiceProbability(roll.Requirement)
+	} else {
+		roll.Expected = oneDieProbability(roll.Requirement)
+	}
+
+	return roll, true
+}
+
+func opponent(side Side) Side {
+	switch side {
+	case SideHome:
+		return SideAway
+	case SideAway:
+		return SideHome
+	}
+	return SideUnknown
+}
+
+func goodBlockFace(die int) bool {
+	return die == blockDefenderStumbles || die == blockDefenderDown
+}
+
+// blockSuccess is whether the block went the attacker's way: any good face
+// if the attacker picks the die, only good faces if the defender does
+func blockSuccess(dice []int, attackerChooses bool) bool {
+	if len(dice) == 0 {
+		return false
+	}
+	for _, die := range dice {
+		if goodBlockFace(die) == attackerChooses {
+			return attackerChooses
+		}
+	}
+	return !attackerChooses
+}
+
+// oneDieProbability is the chance of rolling at least requirement on a D6.
+// A natural 1 always fails and a natural 6 always succeeds.
+func oneDieProbability(requirement int) float64 {
+	if requirement < 2 {
+		requirement = 2
+	}
+	if requirement > 6 {
+		requirement = 6
+	}
+	return float64(7-requirement) / 6
+}
+
+// twoDiceProbability is the chance of rolling at least requirement on 2D6
+func twoDiceProbability(requirement int) float64 {
+	hits := 0
+	for a := 1; a <= 6; a++ {
+		for b := 1; b <= 6; b++ {
+			if a+b >= requirement {
+				hits++
+			}
+		}
+	}
+	return float64(hits) / 36
+}
+
+// blockProbability is the chance of a good face for the attacker when rolling
+// n block dice: at least one of them if the attacker picks, all of them if the defender does
+func blockProbability(n int, attackerChooses bool) float64 {
+	if n == 0 {
+		return 0
+	}
+	if !attackerChooses {
+		hit := 1.0
+		for i := 0; i < n; i++ {
+			hit *= 2.0 / 6
+		}
+		return hit
+	}
+
+	miss := 1.0
+	for i := 0; i < n; i++ {
+		miss *= 4.0 / 6
+	}
+	return 1 - miss
+}
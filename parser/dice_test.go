@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"math"
+	"testing"
+)
+
+func intPtr(i int) *int { return &i }
+
+func TestNewDiceRoll(t *testing.T) {
+	tests := []struct {
+		name     string
+		playing  Side
+		player   Side
+		action   int
+		result   BoardActionResult
+		side     Side
+		success  bool
+		expected float64
+	}{
+		{
+			name:     "dodge",
+			playing:  SideHome,
+			player:   SideHome,
+			action:   0,
+			result:   BoardActionResult{RollType: rollTypeDodge, Requirement: 3, Dice: "(4)"},
+			side:     SideHome,
+			success:  true,
+			expected: 4.0 / 6,
+		},
+		{
+			name:     "attacker picks from two dice",
+			playing:  SideHome,
+			player:   SideHome,
+			action:   actionTypeBlock,
+			result:   BoardActionResult{RollType: rollTypeBlock, Dice: "(0,4)", Chooser: intPtr(0)},
+			side:     SideHome,
+			success:  true,
+			expected: 1 - 16.0/36,
+		},
+		{
+			name:     "defender picks from two dice",
+			playing:  SideHome,
+			player:   SideHome,
+			action:   actionTypeBlock,
+			result:   BoardActionResult{RollType: rollTypeBlock, Dice: "(0,4)", Chooser: intPtr(1)},
+			side:     SideHome,
+			success:  false,
+			expected: 4.0 / 36,
+		},
+		{
+			name:     "defender picks but every die is good",
+			playing:  SideAway,
+			player:   SideAway,
+			action:   actionTypeBlitz,
+			result:   BoardActionResult{RollType: rollTypeBlock, Dice: "(3,4)", Chooser: intPtr(0)},
+			side:     SideAway,
+			success:  true,
+			expected: 4.0 / 36,
+		},
+		{
+			name:     "chooser missing from replay",
+			playing:  SideHome,
+			player:   SideHome,
+			action:   actionTypeBlock,
+			result:   BoardActionResult{RollType: rollTypeBlock, Dice: "(2)"},
+			side:     SideHome,
+			success:  false,
+			expected: 2.0 / 6,
+		},
+		{
+			name:     "armor of block target",
+			playing:  SideHome,
+			player:   SideHome,
+			action:   actionTypeBlock,
+			result:   BoardActionResult{RollType: rollTypeArmor, Requirement: 9, Dice: "(5,5)"},
+			side:     SideHome,
+			success:  true,
+			expected: 10.0 / 36,
+		},
+		{
+			name:     "armor after failed dodge",
+			playing:  SideHome,
+			player:   SideHome,
+			action:   0,
+			result:   BoardActionResult{RollType: rollTypeArmor, Requirement: 9, Dice: "(5,5)"},
+			side:     SideAway,
+			success:  true,
+			expected: 10.0 / 36,
+		},
+		{
+			name:     "injury of defender in the other team's turn",
+			playing:  SideAway,
+			player:   SideHome,
+			action:   0,
+			result:   BoardActionResult{RollType: rollTypeInjury, Requirement: 8, ResultType: 1, Dice: "(1,2)"},
+			side:     SideAway,
+			success:  false,
+			expected: 15.0 / 36,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := RulesEventBoardAction{PlayerID: 1, ActionType: tt.action}
+			roll, ok := newDiceRoll(0, tt.playing, tt.player, 1, action, tt.result)
+			if !ok {
+				t.Fatal("roll wasn't counted")
+			}
+			if roll.Side != tt.side {
+				t.Errorf("side = %q, want %q", roll.Side, tt.side)
+			}
+			if roll.Success != tt.success {
+				t.Errorf("success = %v, want %v", roll.Success, tt.success)
+			}
+			if math.Abs(roll.Expected-tt.expected) > 1e-9 {
+				t.Errorf("expected = %f, want %f", roll.Expected, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewDiceRollIgnoresOtherRolls(t *testing.T) {
+	result := BoardActionResult{RollType: 13, Dice: "(3)"}
+	if _, ok := newDiceRoll(0, SideHome, SideHome, 1, RulesEventBoardAction{}, result); ok {
+		t.Error("push roll counted towards luck")
+	}
+}
+
+func TestLuck(t *testing.T) {
+	var luck Luck
+	luck.Add(DiceRoll{Success: true, Expected: 0.5, Reroll: RerollTeam})
+	luck.Add(DiceRoll{Success: false, Expected: 0.5, Reroll: RerollSkill})
+	luck.Add(DiceRoll{Success: true, Expected: 0.5})
+	luck.Add(DiceRoll{Success: true, Expected: 0.5})
+
+	if luck.Rolls != 4 || luck.Successes != 3 || luck.TeamRerolls != 1 || luck.SkillRerolls != 1 {
+		t.Fatalf("unexpected counts %+v", luck)
+	}
+	if luck.Index != 25 {
+		t.Errorf("index = %f, want 25", luck.Index)
+	}
+
+	var total Luck
+	total.Merge(luck)
+	total.Merge(Luck{Rolls: 4, Successes: 1, Expected: 2})
+	if total.Index != 0 {
+		t.Errorf("merged index = %f, want 0", total.Index)
+	}
+}
+
+func TestParseDice(t *testing.T) {
+	tests := map[string][]int{
+		"":        {},
+		"()":      {},
+		"(3)":     {3},
+		"(3,4,1)": {3, 4, 1},
+		"(2, x)":  {2},
+	}
+	for raw, want := range tests {
+		got := parseDice(raw)
+		if len(got) != len(want) {
+			t.Errorf("parseDice(%q) = %v, want %v", raw, got, want)
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("parseDice(%q) = %v, want %v", raw, got, want)
+			}
+		}
+	}
+}
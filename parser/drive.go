@@ -0,0 +1,161 @@
+package parser
+
+// turnsPerHalf is the number of turns each team plays in a half, turns past
+// the second half are overtime
+const turnsPerHalf = 8
+
+type DriveResult string
+
+const (
+	DriveTouchdown DriveResult = "touchdown"
+	DriveEndOfHalf DriveResult = "end_of_half"
+)
+
+// Turn is one team turn of the timeline. StartStep and EndStep are the replay
+// steps it covers so the events can be looked up in the timeline.
+type Turn struct {
+	Half          int
+	Number        int
+	Side          Side
+	StartStep     int
+	EndStep       int
+	Actions       int
+	Blocks        int
+	Rolls         int
+	FailedRolls   int
+	Touchdown     bool
+	Turnover      bool
+	TurnoverCause string
+	EndReason     string
+}
+
+// Drive runs from a kickoff to the touchdown or the end of the half
+type Drive struct {
+	Half        int
+	Number      int
+	KickingSide Side
+	KickOff     string
+	StartStep   int
+	EndStep     int
+	StartTurn   int
+	EndTurn     int
+	Result      DriveResult
+	ScoringSide Side
+	Turns       []Turn
+}
+
+func halfFor(turn int) int {
+	if turn <= 0 {
+		return 1
+	}
+	return (turn-1)/turnsPerHalf + 1
+}
+
+// Drives groups the timeline of a match into drives and their turns
+func Drives(events []Event) []Drive {
+	drives := make([]Drive, 0)
+	var drive *Drive
+	var turn *Turn
+
+	closeDrive := func() {
+		if drive == nil {
+			return
+		}
+		if turn != nil && (turn.Actions > 0 || turn.Touchdown) {
+			drive.Turns = append(drive.Turns, *turn)
+		}
+		turn = nil
+		if drive.ScoringSide != SideUnknown {
+			drive.Result = DriveTouchdown
+		} else {
+			drive.Result = DriveEndOfHalf
+		}
+		drives = append(drives, *drive)
+		drive = nil
+	}
+
+	for _, evt := range events {
+		if evt.Kind == EventKickOff {
+			closeDrive()
+		}
+		if drive == nil {
+			drive = &Drive{
+				Half:      halfFor(evt.Turn),
+				Number:    len(drives) + 1,
+				StartStep: evt.Step,
+				StartTurn: evt.Turn,
+				Turns:     make([]Turn, 0),
+			}
+			if evt.Kind == EventKickOff {
+				drive.KickingSide = evt.Side
+				drive.KickOff = evt.Result
+			}
+		}
+		// Touchdowns show up on the board after the turn that scored them has
+		// ended, sometimes only once the next kickoff has started
+		if evt.Kind == EventTouchdown && (turn == nil || turn.Actions == 0) {
+			if len(drive.Turns) > 0 {
+				drive.Turns[len(drive.Turns)-1].Touchdown = true
+				drive.ScoringSide = evt.Side
+				continue
+			}
+			if len(drives) > 0 && len(drives[len(drives)-1].Turns) > 0 {
+				previous := &drives[len(drives)-1]
+				previous.Turns[len(previous.Turns)-1].Touchdown = true
+				previous.ScoringSide = evt.Side
+				previous.Result = DriveTouchdown
+				continue
+			}
+		}
+		if turn == nil {
+			turn = &Turn{
+				Half:      halfFor(evt.Turn),
+				Number:    evt.Turn,
+				Side:      evt.Side,
+				StartStep: evt.Step,
+			}
+		}
+
+		drive.EndStep = evt.Step
+		drive.EndTurn = evt.Turn
+		turn.EndStep = evt.Step
+
+		switch evt.Kind {
+		case EventAction:
+			turn.Actions++
+		case EventBlock, EventRoll:
+			turn.Rolls++
+			if evt.Kind == EventBlock {
+				turn.Blocks++
+			}
+			if !evt.Success && evt.Side == turn.Side {
+				turn.FailedRolls++
+			}
+		case EventTouchdown:
+			turn.Touchdown = true
+			drive.ScoringSide = evt.Side
+		case EventTurnover:
+			turn.Turnover = true
+			turn.TurnoverCause = evt.Result
+		case EventEndTurn:
+			turn.Number = evt.Turn
+			turn.Half = halfFor(evt.Turn)
+			turn.Side = evt.Side
+			turn.EndReason = evt.Result
+			drive.Turns = append(drive.Turns, *turn)
+			turn = nil
+		}
+	}
+	closeDrive()
+
+	return drives
+}
+
+// Turns is the list of every team turn of the match in order
+func Turns(events []Event) []Turn {
+	turns := make([]Turn, 0)
+	for _, drive := range Drives(events) {
+		turns = append(turns, drive.Turns...)
+	}
+	return turns
+}
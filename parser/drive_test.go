@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDrivesFromReplay(t *testing.T) {
+	record := parseFixture(t, "match.xml")
+
+	want := []Drive{{
+		Half:        1,
+		Number:      1,
+		KickingSide: SideAway,
+		KickOff:     "Cheering Fans",
+		StartStep:   1,
+		EndStep:     4,
+		StartTurn:   0,
+		EndTurn:     2,
+		Result:      DriveTouchdown,
+		ScoringSide: SideHome,
+		Turns: []Turn{
+			{Half: 1, Number: 1, Side: SideHome, StartStep: 1, EndStep: 2, Actions: 1, Blocks: 1, Rolls: 1, EndReason: "End Of Turn"},
+			{Half: 1, Number: 1, Side: SideAway, StartStep: 3, EndStep: 3, Actions: 1, Rolls: 1, FailedRolls: 1, Turnover: true, TurnoverCause: "Dodge", EndReason: "Turnover"},
+			{Half: 1, Number: 2, Side: SideHome, StartStep: 4, EndStep: 4, Actions: 1, Rolls: 1, Touchdown: true, EndReason: "Touchdown"},
+		},
+	}}
+
+	drives := Drives(record.Timeline)
+	if !reflect.DeepEqual(drives, want) {
+		t.Errorf("Drives() = %+v, want %+v", drives, want)
+	}
+	if turns := Turns(record.Timeline); !reflect.DeepEqual(turns, want[0].Turns) {
+		t.Errorf("Turns() = %+v, want %+v", turns, want[0].Turns)
+	}
+}
+
+func TestDrives(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []Event
+		want   []Drive
+	}{
+		{
+			name: "no events",
+			want: []Drive{},
+		},
+		{
+			name: "touchdown shows up after the next kickoff",
+			events: []Event{
+				{Step: 1, Kind: EventKickOff, Side: SideAway, Result: "Blitz"},
+				{Step: 2, Kind: EventAction, Side: SideHome, Turn: 1},
+				{Step: 2, Kind: EventEndTurn, Side: SideHome, Turn: 1, Result: "Touchdown"},
+				{Step: 3, Kind: EventKickOff, Side: SideHome, Turn: 1, Result: "Riot"},
+				{Step: 3, Kind: EventTouchdown, Side: SideHome, Turn: 1},
+				{Step: 4, Kind: EventAction, Side: SideAway, Turn: 1},
+				{Step: 4, Kind: EventEndTurn, Side: SideAway, Turn: 1, Result: "End Of Turn"},
+			},
+			want: []Drive{
+				{
+					Half: 1, Number: 1, KickingSide: SideAway, KickOff: "Blitz", StartStep: 1, EndStep: 2, EndTurn: 1,
+					Result: DriveTouchdown, ScoringSide: SideHome,
+					Turns: []Turn{{Half: 1, Number: 1, Side: SideHome, StartStep: 1, EndStep: 2, Actions: 1, Touchdown: true, EndReason: "Touchdown"}},
+				},
+				{
+					Half: 1, Number: 2, KickingSide: SideHome, KickOff: "Riot", StartStep: 3, EndStep: 4, StartTurn: 1, EndTurn: 1,
+					Result: DriveEndOfHalf,
+					Turns:  []Turn{{Half: 1, Number: 1, Side: SideAway, StartStep: 3, EndStep: 4, Actions: 1, EndReason: "End Of Turn"}},
+				},
+			},
+		},
+		{
+			name: "second half",
+			events: []Event{
+				{Step: 10, Kind: EventKickOff, Side: SideHome, Turn: 8},
+				{Step: 11, Kind: EventAction, Side: SideAway, Turn: 9},
+				{Step: 11, Kind: EventEndTurn, Side: SideAway, Turn: 9, Result: "End Of Half"},
+			},
+			want: []Drive{{
+				Half: 1, Number: 1, KickingSide: SideHome, StartStep: 10, EndStep: 11, StartTurn: 8, EndTurn: 9,
+				Result: DriveEndOfHalf,
+				Turns:  []Turn{{Half: 2, Number: 9, Side: SideAway, StartStep: 10, EndStep: 11, Actions: 1, EndReason: "End Of Half"}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Drives(tt.events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Drives() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHalfFor(t *testing.T) {
+	tests := []struct {
+		turn int
+		want int
+	}{
+		{0, 1},
+		{1, 1},
+		{8, 1},
+		{9, 2},
+		{16, 2},
+		{17, 3},
+	}
+
+	for _, tt := range tests {
+		if got := halfFor(tt.turn); got != tt.want {
+			t.Errorf("halfFor(%d) = %d, want %d", tt.turn, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorKind is a machine readable identifier of what went wrong while parsing
+type ErrorKind string
+
+const (
+	KindUnknownFormat       ErrorKind = "unknown_format"
+	KindInvalidArchive      ErrorKind = "invalid_archive"
+	KindXMLSyntax           ErrorKind = "xml_syntax"
+	KindNoSteps             ErrorKind = "no_steps"
+	KindMissingGameFinished ErrorKind = "missing_game_finished"
+	KindCoachCount          ErrorKind = "coach_count"
+)
+
+// Error is returned for every problem with the replay itself. Step, Line and
+// Offset point at where the problem was found and are -1 when they don't apply.
+type Error struct {
+	Kind   ErrorKind
+	Step   int
+	Line   int
+	Offset int64
+	Err    error
+}
+
+var (
+	ErrUnknownFormat       = newError(KindUnknownFormat, nil)
+	ErrInvalidArchive      = newError(KindInvalidArchive, nil)
+	ErrXMLSyntax           = newError(KindXMLSyntax, nil)
+	ErrNoSteps             = newError(KindNoSteps, nil)
+	ErrMissingGameFinished = newError(KindMissingGameFinished, nil)
+	ErrCoachCount          = newError(KindCoachCount, nil)
+)
+
+func newError(kind ErrorKind, err error) *Error {
+	return &Error{
+		Kind:   kind,
+		Step:   -1,
+		Line:   -1,
+		Offset: -1,
+		Err:    err,
+	}
+}
+
+func (e *Error) Error() string {
+	location := make([]string, 0)
+	if e.Step >= 0 {
+		location = append(location, fmt.Sprintf("step %d", e.Step))
+	}
+	if e.Line >= 0 {
+		location = append(location, fmt.Sprintf("line %d", e.Line))
+	}
+	if e.Offset >= 0 {
+		location = append(location, fmt.Sprintf("offset %d", e.Offset))
+	}
+
+	msg := string(e.Kind)
+	if len(location) > 0 {
+		msg = fmt.Sprintf("%s at %s", msg, strings.Join(location, ", "))
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrNoSteps) and the like match on the kind only
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind
+}
+
+// KindOf returns the kind of a parser error or an empty string if err isn't one
+func KindOf(err error) ErrorKind {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.Kind
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *Error
+		want string
+	}{
+		{"kind only", newError(KindNoSteps, nil), "no_steps"},
+		{"with location", &Error{Kind: KindXMLSyntax, Step: 3, Line: 120, Offset: 4096}, "xml_syntax at step 3, line 120, offset 4096"},
+		{"with cause", &Error{Kind: KindCoachCount, Step: 7, Line: -1, Offset: -1, Err: errors.New("Expected 2 coaches, found 1")}, "coach_count at step 7: Expected 2 coaches, found 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorMatching(t *testing.T) {
+	cause := errors.New("cause")
+	err := fmt.Errorf("Failed to parse: %w", &Error{Kind: KindXMLSyntax, Step: 2, Err: cause})
+
+	if !errors.Is(err, ErrXMLSyntax) {
+		t.Errorf("errors.Is(err, ErrXMLSyntax) = false")
+	}
+	if errors.Is(err, ErrNoSteps) {
+		t.Errorf("errors.Is(err, ErrNoSteps) = true")
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("errors.Is(err, cause) = false")
+	}
+	if KindOf(err) != KindXMLSyntax {
+		t.Errorf("KindOf() = %s, want %s", KindOf(err), KindXMLSyntax)
+	}
+	if KindOf(cause) != "" {
+		t.Errorf("KindOf() = %s for an error that's no parser error", KindOf(cause))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	match := string(readFixture(t, "match.xml"))
+	finished := strings.Index(match, "  <ReplayStep>\n    <RulesEventGameFinished>")
+	secondCoach := strings.LastIndex(match, "<CoachResult>")
+	coachesEnd := strings.Index(match, "</CoachResults>")
+	dodge := strings.Index(match, "<PlayerId>12</PlayerId>")
+
+	tests := []struct {
+		name   string
+		replay string
+		err    error
+		step   int
+	}{
+		{"no steps", "<Replay></Replay>", ErrNoSteps, -1},
+		{"missing game finished", match[:finished] + "</Replay>", ErrMissingGameFinished, 4},
+		{"one coach", match[:secondCoach] + match[coachesEnd:], ErrCoachCount, 5},
+		{"cut off", match[:dodge], ErrXMLSyntax, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.replay))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+
+			var perr *Error
+			if errors.As(err, &perr) && perr.Step != tt.step {
+				t.Errorf("Step = %d, want %d", perr.Step, tt.step)
+			}
+		})
+	}
+}
+
+func TestParseDoesNotPanic(t *testing.T) {
+	match := readFixture(t, "match.xml")
+	// Cutting the replay off anywhere must give an error or a record, never a panic
+	for size := 0; size < len(match); size += 97 {
+		data := match[:size]
+		if _, err := ParseFile(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("ParseFile() of the first %d bytes succeeded", size)
+		}
+	}
+}
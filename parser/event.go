@@ -0,0 +1,261 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type EventKind string
+
+const (
+	EventAction    EventKind = "action"
+	EventBlock     EventKind = "block"
+	EventArmor     EventKind = "armor"
+	EventInjury    EventKind = "injury"
+	EventRoll      EventKind = "roll"
+	EventTurnover  EventKind = "turnover"
+	EventEndTurn   EventKind = "end_turn"
+	EventKickOff   EventKind = "kickoff"
+	EventTouchdown EventKind = "touchdown"
+)
+
+type Side string
+
+const (
+	SideHome    Side = "home"
+	SideAway    Side = "away"
+	SideUnknown Side = ""
+)
+
+// Raw values of the replay that decide how an event gets classified
+const (
+	rollTypeArmor  = 3
+	rollTypeInjury = 4
+	rollTypeBlock  = 5
+
+	resultTypePassed = 0
+
+	endTurnReasonTurnover = 2
+)
+
+// Event is a single entry of the match timeline. Which fields are set depends on Kind.
+type Event struct {
+	Step        int
+	Kind        EventKind
+	Side        Side
+	Turn        int
+	PlayerID    int
+	Action      string
+	Roll        string
+	Dice        []int
+	Requirement int
+	Success     bool
+	Result      string
+}
+
+func sideFromIndex(idx int) Side {
+	switch idx {
+	case 0:
+		return SideHome
+	case 1:
+		return SideAway
+	}
+	return SideUnknown
+}
+
+// timeline keeps the state needed to turn consecutive replay steps into events
+type timeline struct {
+	events      []Event
+	rolls       []DiceRoll
+	players     map[int]Side
+	touchdowns  [2]int
+	turns       int
+	sideTurns   map[Side]int
+	lastEndTurn *RulesEventEndTurn
+	weather     []WeatherChange
+	// failure is the last failed roll of the team whose turn it is, it's
+	// what caused the turnover if the turn ends in one
+	failure *Event
+}
+
+func newTimeline() *timeline {
+	return &timeline{
+		events:    make([]Event, 0),
+		rolls:     make([]DiceRoll, 0),
+		players:   make(map[int]Side),
+		sideTurns: make(map[Side]int),
+		weather:   make([]WeatherChange, 0),
+	}
+}
+
+func (t *timeline) add(idx int, step ReplayStep) {
+	board := step.BoardState
+	for i, team := range board.Teams {
+		for _, player := range team.Players {
+			t.players[player.ID] = sideFromIndex(i)
+		}
+	}
+
+	side := sideFromIndex(board.CurrentTeam)
+	turn := 0
+	if board.CurrentTeam >= 0 && board.CurrentTeam < len(board.Teams) {
+		turn = board.Teams[board.CurrentTeam].GameTurn
+	}
+
+	for i, team := range board.Teams {
+		if team.GameTurn > t.turns {
+			t.turns = team.GameTurn
+		}
+		if team.GameTurn > t.sideTurns[sideFromIndex(i)] {
+			t.sideTurns[sideFromIndex(i)] = team.GameTurn
+		}
+	}
+
+	if board.Weather != 0 {
+		weather := WeatherMapping.Name(board.Weather)
+		if len(t.weather) == 0 || t.weather[len(t.weather)-1].Weather != weather {
+			t.weather = append(t.weather, WeatherChange{
+				Step:    idx,
+				Turn:    turn,
+				Weather: weather,
+			})
+		}
+	}
+
+	if step.RulesEventKickOffTable != nil {
+		t.events = append(t.events, Event{
+			Step:   idx,
+			Kind:   EventKickOff,
+			Side:   side,
+			Turn:   turn,
+			Dice:   parseDice(step.RulesEventKickOffTable.Dice),
+			Result: KickOffMapping.Name(step.RulesEventKickOffTable.Event),
+		})
+	}
+
+	for _, action := range step.RulesEventBoardAction {
+		playerSide := t.players[action.PlayerID]
+		t.events = append(t.events, Event{
+			Step:     idx,
+			Kind:     EventAction,
+			Side:     playerSide,
+			Turn:     turn,
+			PlayerID: action.PlayerID,
+			Action:   ActionTypeMapping.Name(action.ActionType),
+		})
+
+		for _, result := range action.Results {
+			evt := Event{
+				Step:        idx,
+				Kind:        EventRoll,
+				Side:        playerSide,
+				Turn:        turn,
+				PlayerID:    action.PlayerID,
+				Action:      ActionTypeMapping.Name(action.ActionType),
+				Roll:        RollTypeMapping.Name(result.RollType),
+				Dice:        parseDice(result.Dice),
+				Requirement: result.Requirement,
+				Success:     result.ResultType == resultTypePassed,
+			}
+
+			switch result.RollType {
+			case rollTypeBlock:
+				evt.Kind = EventBlock
+				faces := make([]string, 0, len(evt.Dice))
+				for _, die := range evt.Dice {
+					faces = append(faces, BlockDiceMapping.Name(die))
+				}
+				evt.Result = strings.Join(faces, ", ")
+			case rollTypeArmor:
+				evt.Kind = EventArmor
+			case rollTypeInjury:
+				evt.Kind = EventInjury
+			}
+
+			t.events = append(t.events, evt)
+			if !evt.Success && playerSide == side && (evt.Kind == EventRoll || evt.Kind == EventBlock) {
+				failure := evt
+				t.failure = &failure
+			}
+
+			if roll, ok := newDiceRoll(idx, side, playerSide, turn, action, result); ok {
+				t.rolls = append(t.rolls, roll)
+			}
+		}
+	}
+
+	for i, team := range board.Teams {
+		if i >= len(t.touchdowns) {
+			break
+		}
+		for team.Touchdown > t.touchdowns[i] {
+			t.touchdowns[i]++
+			t.events = append(t.events, Event{
+				Step: idx,
+				Kind: EventTouchdown,
+				Side: sideFromIndex(i),
+				Turn: team.GameTurn,
+			})
+		}
+	}
+
+	if step.RulesEventEndTurn != nil {
+		endTurn := step.RulesEventEndTurn
+		t.lastEndTurn = endTurn
+		if endTurn.Reason == endTurnReasonTurnover {
+			turnover := Event{
+				Step: idx,
+				Kind: EventTurnover,
+				Side: sideFromIndex(endTurn.PlayingTeam),
+				Turn: turn,
+			}
+			if t.failure != nil {
+				turnover.PlayerID = t.failure.PlayerID
+				turnover.Action = t.failure.Action
+				turnover.Roll = t.failure.Roll
+				turnover.Result = turnoverCause(*t.failure)
+			}
+			t.events = append(t.events, turnover)
+		}
+		t.failure = nil
+		t.events = append(t.events, Event{
+			Step:   idx,
+			Kind:   EventEndTurn,
+			Side:   sideFromIndex(endTurn.PlayingTeam),
+			Turn:   turn,
+			Result: EndTurnReasonMapping.Name(endTurn.Reason),
+		})
+	}
+}
+
+// turnoverCause names the failed roll a turnover came from, a block is
+// named by the dice faces since "Block" alone says nothing about what went wrong
+func turnoverCause(failure Event) string {
+	if failure.Kind == EventBlock && failure.Result != "" {
+		return fmt.Sprintf("%s (%s)", failure.Roll, failure.Result)
+	}
+	if failure.Roll != "" {
+		return failure.Roll
+	}
+	return failure.Action
+}
+
+// parseDice turns the "(3,4,1)" lists of the replay into a slice of ints
+func parseDice(raw string) []int {
+	dice := make([]int, 0)
+	raw = strings.Trim(raw, "()")
+	if raw == "" {
+		return dice
+	}
+
+	for _, d := range strings.Split(raw, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(d))
+		if err != nil {
+			continue
+		}
+		dice = append(dice, value)
+	}
+
+	return dice
+}
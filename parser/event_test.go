@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTimeline(t *testing.T) {
+	record := parseFixture(t, "match.xml")
+
+	want := []Event{
+		{Step: 1, Kind: EventKickOff, Side: SideAway, Dice: []int{2, 4}, Result: "Cheering Fans"},
+		{Step: 2, Kind: EventAction, Side: SideHome, Turn: 1, PlayerID: 2, Action: "Block"},
+		{Step: 2, Kind: EventBlock, Side: SideHome, Turn: 1, PlayerID: 2, Action: "Block", Roll: "Block", Dice: []int{2, 4}, Success: true, Result: "Pushed, Defender Down"},
+		{Step: 2, Kind: EventArmor, Side: SideHome, Turn: 1, PlayerID: 2, Action: "Block", Roll: "Armor", Dice: []int{5, 6}, Requirement: 10, Success: true},
+		{Step: 2, Kind: EventInjury, Side: SideHome, Turn: 1, PlayerID: 2, Action: "Block", Roll: "Injury", Dice: []int{5, 5}, Requirement: 10, Success: true},
+		{Step: 2, Kind: EventEndTurn, Side: SideHome, Turn: 1, Result: "End Of Turn"},
+		{Step: 3, Kind: EventAction, Side: SideAway, Turn: 1, PlayerID: 12, Action: "Move"},
+		{Step: 3, Kind: EventRoll, Side: SideAway, Turn: 1, PlayerID: 12, Action: "Move", Roll: "Dodge", Dice: []int{1}, Requirement: 3},
+		{Step: 3, Kind: EventTurnover, Side: SideAway, Turn: 1, PlayerID: 12, Action: "Move", Roll: "Dodge", Result: "Dodge"},
+		{Step: 3, Kind: EventEndTurn, Side: SideAway, Turn: 1, Result: "Turnover"},
+		{Step: 4, Kind: EventAction, Side: SideHome, Turn: 2, PlayerID: 1, Action: "Move"},
+		{Step: 4, Kind: EventRoll, Side: SideHome, Turn: 2, PlayerID: 1, Action: "Move", Roll: "GFI", Dice: []int{4}, Requirement: 2, Success: true},
+		{Step: 4, Kind: EventTouchdown, Side: SideHome, Turn: 2},
+		{Step: 4, Kind: EventEndTurn, Side: SideHome, Turn: 2, Result: "Touchdown"},
+	}
+
+	if len(record.Timeline) != len(want) {
+		t.Fatalf("Timeline has %d events, want %d: %+v", len(record.Timeline), len(want), record.Timeline)
+	}
+	for i := range want {
+		got := record.Timeline[i]
+		if len(got.Dice) == 0 && len(want[i].Dice) == 0 {
+			got.Dice = want[i].Dice
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("Timeline[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	if record.Match.Turns != 2 {
+		t.Errorf("Turns = %d, want 2", record.Match.Turns)
+	}
+}
+
+func TestTurnoverCause(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure Event
+		want    string
+	}{
+		{"block names the faces", Event{Kind: EventBlock, Roll: "Block", Action: "Blitz", Result: "Attacker Down, Both Down"}, "Block (Attacker Down, Both Down)"},
+		{"roll", Event{Kind: EventRoll, Roll: "GFI", Action: "Move"}, "GFI"},
+		{"action without a roll", Event{Kind: EventRoll, Action: "Pass"}, "Pass"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := turnoverCause(tt.failure); got != tt.want {
+				t.Errorf("turnoverCause() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSideFromIndex(t *testing.T) {
+	tests := []struct {
+		idx  int
+		want Side
+	}{
+		{0, SideHome},
+		{1, SideAway},
+		{2, SideUnknown},
+		{-1, SideUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := sideFromIndex(tt.idx); got != tt.want {
+			t.Errorf("sideFromIndex(%d) = %s, want %s", tt.idx, got, tt.want)
+		}
+	}
+}
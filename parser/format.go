@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// headerSize is the number of bytes handed to Format.Detect. It's large enough
+// to cover the tar magic at offset 257.
+const headerSize = 512
+
+// Format is a kind of uploaded replay file the parser knows how to decode
+type Format interface {
+	// Name is stored on the record so it's known later what the replay was decoded from
+	Name() string
+	// Detect reports whether the first bytes of a file belong to this format
+	Detect(header []byte) bool
+	// Decode parses the whole file into a record
+	Decode(r io.ReaderAt, size int64, opts Options) (Record, error)
+}
+
+var (
+	formatsMx = &sync.RWMutex{}
+	formats   = make([]Format, 0)
+)
+
+func init() {
+	RegisterFormat(BBRZFormat{})
+	RegisterFormat(GzipFormat{})
+	RegisterFormat(TarFormat{})
+	RegisterFormat(XMLFormat{})
+}
+
+// RegisterFormat adds a format to the registry. Formats are tried in the order
+// they were registered so more specific ones should be registered first.
+func RegisterFormat(f Format) {
+	formatsMx.Lock()
+	defer formatsMx.Unlock()
+
+	formats = append(formats, f)
+}
+
+func Formats() []Format {
+	formatsMx.RLock()
+	defer formatsMx.RUnlock()
+
+	list := make([]Format, len(formats))
+	copy(list, formats)
+	return list
+}
+
+// DetectFormat sniffs the beginning of the file and returns the first registered format that claims it
+func DetectFormat(r io.ReaderAt) (Format, error) {
+	header := make([]byte, headerSize)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Failed to read file header: %w", err)
+	}
+	header = header[:n]
+
+	for _, f := range Formats() {
+		if f.Detect(header) {
+			return f, nil
+		}
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// ParseFile detects the format of the file and decodes it with the matching decoder
+func ParseFile(r io.ReaderAt, size int64) (Record, error) {
+	return ParseFileWithOptions(r, size, Options{})
+}
+
+func ParseFileWithOptions(r io.ReaderAt, size int64, opts Options) (Record, error) {
+	f, err := DetectFormat(r)
+	if err != nil {
+		return Record{}, err
+	}
+
+	record, err := f.Decode(r, size, opts)
+	if err != nil {
+		return Record{}, err
+	}
+	record.Format = f.Name()
+
+	return record, nil
+}
+
+// XMLFormat is the raw Blood Bowl 2 replay XML
+type XMLFormat struct{}
+
+func (XMLFormat) Name() string { return "xml" }
+
+func (XMLFormat) Detect(header []byte) bool {
+	header = bytes.TrimPrefix(header, []byte("\xef\xbb\xbf"))
+	header = bytes.TrimLeft(header, " \t\r\n")
+	return bytes.HasPrefix(header, []byte("<?xml")) || bytes.HasPrefix(header, []byte("<Replay"))
+}
+
+func (XMLFormat) Decode(r io.ReaderAt, size int64, opts Options) (Record, error) {
+	return ParseWithOptions(io.NewSectionReader(r, 0, size), opts)
+}
+
+// BBRZFormat is the zip file the game saves replays in, the XML is the first entry
+type BBRZFormat struct{}
+
+func (BBRZFormat) Name() string { return "bbrz" }
+
+func (BBRZFormat) Detect(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("PK\x03\x04"))
+}
+
+func (BBRZFormat) Decode(r io.ReaderAt, size int64, opts Options) (Record, error) {
+	res, err := zip.NewReader(r, size)
+	if err != nil && opts.Lenient {
+		rc, truncErr := openTruncatedZip(r, size)
+		if truncErr != nil {
+			return Record{}, newError(KindInvalidArchive, fmt.Errorf("Failed to open truncated zip file: %w", truncErr))
+		}
+		defer rc.Close()
+
+		return ParseWithOptions(rc, opts)
+	}
+	if err != nil {
+		return Record{}, newError(KindInvalidArchive, fmt.Errorf("Failed to open zip file: %w", err))
+	}
+
+	for _, f := range res.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return Record{}, newError(KindInvalidArchive, fmt.Errorf("Failed to open %s in zip file: %w", f.Name, err))
+		}
+		defer rc.Close()
+
+		return ParseWithOptions(rc, opts)
+	}
+
+	return Record{}, newError(KindInvalidArchive, fmt.Errorf("Zip file is empty"))
+}
+
+// GzipFormat is a gzip compressed replay XML
+type GzipFormat struct{}
+
+func (GzipFormat) Name() string { return "gzip" }
+
+func (GzipFormat) Detect(header []byte) bool {
+	return bytes.HasPrefix(header, []byte{0x1f, 0x8b})
+}
+
+func (GzipFormat) Decode(r io.ReaderAt, size int64, opts Options) (Record, error) {
+	gr, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return Record{}, newError(KindInvalidArchive, fmt.Errorf("Failed to open gzip stream: %w", err))
+	}
+	defer gr.Close()
+
+	return ParseWithOptions(gr, opts)
+}
+
+// TarFormat is an uncompressed tar archive, the replay XML is the first regular file in it
+type TarFormat struct{}
+
+func (TarFormat) Name() string { return "tar" }
+
+func (TarFormat) Detect(header []byte) bool {
+	return len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar"))
+}
+
+func (TarFormat) Decode(r io.ReaderAt, size int64, opts Options) (Record, error) {
+	tr := tar.NewReader(io.NewSectionReader(r, 0, size))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return Record{}, newError(KindInvalidArchive, fmt.Errorf("Tar archive is empty"))
+		}
+		if err != nil {
+			return Record{}, newError(KindInvalidArchive, fmt.Errorf("Failed to read tar archive: %w", err))
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			return ParseWithOptions(tr, opts)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func tarred(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	if err := w.WriteHeader(&tar.Header{Name: "replays", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteHeader(&tar.Header{Name: "replays/replay.xml", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectFormat(t *testing.T) {
+	data := readFixture(t, "match.xml")
+
+	tests := []struct {
+		name string
+		file []byte
+		want string
+	}{
+		{"xml", data, "xml"},
+		{"xml with byte order mark", append([]byte("\xef\xbb\xbf"), data...), "xml"},
+		{"xml without declaration", []byte("\n  <Replay></Replay>"), "xml"},
+		{"bbrz", zipped(t, data), "bbrz"},
+		{"gzip", gzipped(t, data), "gzip"},
+		{"tar", tarred(t, data), "tar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := DetectFormat(bytes.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("DetectFormat() error = %v", err)
+			}
+			if f.Name() != tt.want {
+				t.Errorf("DetectFormat() = %s, want %s", f.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFileFormats(t *testing.T) {
+	data := readFixture(t, "match.xml")
+
+	tests := []struct {
+		name string
+		file []byte
+		kind ErrorKind
+	}{
+		{"tar", tarred(t, data), ""},
+		{"unknown format", []byte("GIF89a"), KindUnknownFormat},
+		{"empty file", []byte{}, KindUnknownFormat},
+		{"broken gzip", []byte{0x1f, 0x8b, 0x00}, KindInvalidArchive},
+		{"broken zip", []byte("PK\x03\x04broken"), KindInvalidArchive},
+		{"tar without a replay", tarred(t, nil)[:512], KindInvalidArchive},
+		{"empty replay in tar", tarred(t, nil), KindNoSteps},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := ParseFile(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if tt.kind == "" {
+				if err != nil {
+					t.Fatalf("ParseFile() error = %v", err)
+				}
+				if record.MatchID != "1001" {
+					t.Errorf("MatchID = %s, want 1001", record.MatchID)
+				}
+				return
+			}
+			if KindOf(err) != tt.kind {
+				t.Errorf("ParseFile() error = %v, want kind %s", err, tt.kind)
+			}
+		})
+	}
+}
+
+// magicFormat claims files starting with TEST and returns a record without parsing them
+type magicFormat struct{}
+
+func (magicFormat) Name() string { return "magic" }
+
+func (magicFormat) Detect(header []byte) bool { return bytes.HasPrefix(header, []byte("TEST")) }
+
+func (magicFormat) Decode(r io.ReaderAt, size int64, opts Options) (Record, error) {
+	return Record{MatchID: "magic"}, nil
+}
+
+func TestRegisterFormat(t *testing.T) {
+	before := Formats()
+	defer func() {
+		formatsMx.Lock()
+		formats = before
+		formatsMx.Unlock()
+	}()
+
+	RegisterFormat(magicFormat{})
+
+	file := []byte("TEST replay")
+	record, err := ParseFile(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	if record.Format != "magic" || record.MatchID != "magic" {
+		t.Errorf("ParseFile() = %s %s, want the record of the registered format", record.Format, record.MatchID)
+	}
+
+	if _, err := DetectFormat(bytes.NewReader([]byte("NOPE"))); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("DetectFormat() error = %v, want %v", err, ErrUnknownFormat)
+	}
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GameID is a numeric ID from the replay together with the name it maps to.
+// Name is nil if the ID is missing from the mapping tables.
+type GameID struct {
+	ID   int
+	Name *string
+}
+
+func NewGameID(m *Mapping, id int) GameID {
+	gid := GameID{ID: id}
+	if name, ok := m.Get(fmt.Sprint(id)); ok {
+		gid.Name = &name
+	}
+	return gid
+}
+
+func (g GameID) Known() bool {
+	return g.Name != nil
+}
+
+func (g GameID) String() string {
+	if g.Name == nil {
+		return fmt.Sprintf("unknown (%d)", g.ID)
+	}
+	return *g.Name
+}
+
+// UnmarshalJSON also accepts the plain names that were stored before IDs were kept
+func (g *GameID) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		if name != "" {
+			g.Name = &name
+		}
+		return nil
+	}
+
+	type plain GameID
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*g = GameID(p)
+	return nil
+}
+
+// parseIDList turns the "(1,5,12)" lists of the replay into GameIDs
+func parseIDList(m *Mapping, raw string) []GameID {
+	ids := make([]GameID, 0)
+	for _, id := range parseDice(raw) {
+		ids = append(ids, NewGameID(m, id))
+	}
+	return ids
+}
+
+func parseGameID(m *Mapping, raw string) GameID {
+	id, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return GameID{}
+	}
+	return NewGameID(m, id)
+}
+
+// UnmappedID is an ID found in a replay that none of the mapping tables know about
+type UnmappedID struct {
+	Mapping string
+	ID      int
+	Count   int
+}
+
+type unmappedCollector map[string]map[int]int
+
+func (c unmappedCollector) add(m *Mapping, ids ...GameID) {
+	for _, id := range ids {
+		// 0 is what the game uses for "nothing", e.g. a missing race
+		if id.Known() || id.ID == 0 {
+			continue
+		}
+		if _, ok := c[m.Table()]; !ok {
+			c[m.Table()] = make(map[int]int)
+		}
+		c[m.Table()][id.ID]++
+	}
+}
+
+func (c unmappedCollector) list() []UnmappedID {
+	list := make([]UnmappedID, 0)
+	for mapping, ids := range c {
+		for id, count := range ids {
+			list = append(list, UnmappedID{
+				Mapping: mapping,
+				ID:      id,
+				Count:   count,
+			})
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Mapping != list[j].Mapping {
+			return list[i].Mapping < list[j].Mapping
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+func findUnmapped(teams ...TeamStats) []UnmappedID {
+	c := make(unmappedCollector)
+	for _, team := range teams {
+		c.add(RaceMapping, team.Race.GameID)
+		for _, player := range team.PlayerResults {
+			c.add(PlayerTypesMapping, player.Type)
+			c.add(SkillMapping, player.Skills...)
+			c.add(CasualtyMapping, player.Casualties...)
+			c.add(CasualtyMapping, player.LastingInjuries...)
+		}
+		for _, inducement := range team.Inducements.Other {
+			c.add(InducementMapping, inducement.Type)
+		}
+	}
+	return c.list()
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGameID(t *testing.T) {
+	known := NewGameID(RaceMapping, 1)
+	if !known.Known() || known.String() != "Human" {
+		t.Errorf("NewGameID(RaceMapping, 1) = %v, want Human", known)
+	}
+
+	unknown := NewGameID(RaceMapping, 999)
+	if unknown.Known() || unknown.String() != "unknown (999)" {
+		t.Errorf("NewGameID(RaceMapping, 999) = %v, want unknown (999)", unknown)
+	}
+}
+
+func TestGameIDUnmarshalJSON(t *testing.T) {
+	human := "Human"
+	tests := []struct {
+		name string
+		data string
+		want GameID
+	}{
+		{"stored with the ID", `{"ID":1,"Name":"Human"}`, GameID{ID: 1, Name: &human}},
+		{"unknown ID", `{"ID":999,"Name":null}`, GameID{ID: 999}},
+		{"plain name stored before IDs were kept", `"Human"`, GameID{Name: &human}},
+		{"empty name", `""`, GameID{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got GameID
+			if err := json.Unmarshal([]byte(tt.data), &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindUnmapped(t *testing.T) {
+	data := readFixture(t, "match.xml")
+	// An unknown race, skill and casualty the way a game update would add them
+	data = bytes.Replace(data, []byte("<IdRace>4</IdRace>"), []byte("<IdRace>99</IdRace>"), -1)
+	data = bytes.Replace(data, []byte("<ListSkills>(7,8)</ListSkills>"), []byte("<ListSkills>(7,8,900)</ListSkills>"), 1)
+	data = bytes.Replace(data, []byte("<Casualty1>14</Casualty1>"), []byte("<Casualty1>77</Casualty1>"), 1)
+
+	record, err := ParseFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+
+	want := []UnmappedID{
+		{Mapping: "casualties", ID: 77, Count: 1},
+		{Mapping: "races", ID: 99, Count: 1},
+		{Mapping: "skills", ID: 900, Count: 1},
+	}
+	if !reflect.DeepEqual(record.Unmapped, want) {
+		t.Errorf("Unmapped = %+v, want %+v", record.Unmapped, want)
+	}
+
+	if len(parseFixture(t, "match.xml").Unmapped) != 0 {
+		t.Errorf("Unmapped is not empty for a replay with known IDs only")
+	}
+}
@@ -0,0 +1,88 @@
+package parser
+
+// Raw inducement types that get their own field in Inducements
+const (
+	inducementBabe       = 1
+	inducementBribe      = 2
+	inducementApothecary = 6
+	inducementWizard     = 7
+	inducementStarPlayer = 8
+	inducementMercenary  = 9
+)
+
+type RulesEventInducementsInfos struct {
+	Teams []TeamInducements `xml:"TeamInducements>TeamInducementsInfos"`
+}
+
+type TeamInducements struct {
+	TeamID      int `xml:"TeamId"`
+	Cash        int
+	Inducements []InducementInfo `xml:"ListInducements>InducementInfo"`
+}
+
+type InducementInfo struct {
+	Type  int
+	Count int
+}
+
+// Inducements are what a team bought before the match. Star players and
+// mercenaries are listed by name, the players themselves are in PlayerResults.
+type Inducements struct {
+	GoldSpent    int
+	StarPlayers  []string
+	Mercenaries  []string
+	Wizards      int
+	Bribes       int
+	Babes        int
+	Apothecaries int
+	Other        []Inducement
+}
+
+type Inducement struct {
+	Type  GameID
+	Count int
+}
+
+func newInducements(raw *TeamInducements, players []PlayerResult) Inducements {
+	inducements := Inducements{
+		StarPlayers: make([]string, 0),
+		Mercenaries: make([]string, 0),
+		Other:       make([]Inducement, 0),
+	}
+
+	for _, player := range players {
+		if player.StarPlayer {
+			inducements.StarPlayers = append(inducements.StarPlayers, player.Name)
+		}
+		if player.Mercenary {
+			inducements.Mercenaries = append(inducements.Mercenaries, player.Name)
+		}
+	}
+
+	if raw == nil {
+		return inducements
+	}
+
+	inducements.GoldSpent = raw.Cash
+	for _, item := range raw.Inducements {
+		switch item.Type {
+		case inducementWizard:
+			inducements.Wizards += item.Count
+		case inducementBribe:
+			inducements.Bribes += item.Count
+		case inducementBabe:
+			inducements.Babes += item.Count
+		case inducementApothecary:
+			inducements.Apothecaries += item.Count
+		case inducementStarPlayer, inducementMercenary:
+			// the players are picked up from the results, they have names there
+		default:
+			inducements.Other = append(inducements.Other, Inducement{
+				Type:  NewGameID(InducementMapping, item.Type),
+				Count: item.Count,
+			})
+		}
+	}
+
+	return inducements
+}
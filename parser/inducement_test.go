@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewInducements(t *testing.T) {
+	igor := "Igor"
+	players := []PlayerResult{
+		{Name: "Griff"},
+		{Name: "Morg", StarPlayer: true},
+		{Name: "Hired Blade", Mercenary: true},
+	}
+
+	tests := []struct {
+		name    string
+		raw     *TeamInducements
+		players []PlayerResult
+		want    Inducements
+	}{
+		{
+			name: "none",
+			want: Inducements{StarPlayers: []string{}, Mercenaries: []string{}, Other: []Inducement{}},
+		},
+		{
+			name:    "players without the inducements event",
+			players: players,
+			want:    Inducements{StarPlayers: []string{"Morg"}, Mercenaries: []string{"Hired Blade"}, Other: []Inducement{}},
+		},
+		{
+			name: "everything",
+			raw: &TeamInducements{Cash: 320000, Inducements: []InducementInfo{
+				{Type: inducementWizard, Count: 1},
+				{Type: inducementBribe, Count: 2},
+				{Type: inducementBabe, Count: 1},
+				{Type: inducementApothecary, Count: 1},
+				{Type: inducementStarPlayer, Count: 1},
+				{Type: inducementMercenary, Count: 1},
+				{Type: 5, Count: 1},
+				{Type: 99, Count: 1},
+			}},
+			players: players,
+			want: Inducements{
+				GoldSpent:    320000,
+				StarPlayers:  []string{"Morg"},
+				Mercenaries:  []string{"Hired Blade"},
+				Wizards:      1,
+				Bribes:       2,
+				Babes:        1,
+				Apothecaries: 1,
+				Other: []Inducement{
+					{Type: GameID{ID: 5, Name: &igor}, Count: 1},
+					{Type: GameID{ID: 99}, Count: 1},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newInducements(tt.raw, tt.players); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newInducements() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInducementsFromReplay(t *testing.T) {
+	record := parseFixture(t, "match.xml")
+
+	home := record.Home.Inducements
+	if home.GoldSpent != 100000 || home.Bribes != 1 || !reflect.DeepEqual(home.StarPlayers, []string{"Morg"}) {
+		t.Errorf("Home Inducements = %+v, want 100000 spent on a bribe and Morg", home)
+	}
+	// Star players aren't part of the roster
+	for _, entry := range record.Home.RosterBefore {
+		if entry.Name == "Morg" {
+			t.Errorf("RosterBefore lists the star player")
+		}
+	}
+
+	away := record.Away.Inducements
+	if away.GoldSpent != 0 || len(away.StarPlayers) != 0 {
+		t.Errorf("Away Inducements = %+v, want none", away)
+	}
+}
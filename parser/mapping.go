@@ -1,258 +1,291 @@
 package parser
 
-var PlayerTypesMapping = map[string]string{
-	"1": "Lineman",
-	"2": "Catcher",
-	"3": "Thrower",
-	"4": "Blitzer",
-	"5": "Ogre",
-
-	"6":  "Long Beard",
-	"7":  "Runner",
-	"8":  "Blitzer",
-	"9":  "Troll Slayer",
-	"10": "Deathroller",
-
-	"11": "Lineman",
-	"12": "Catcher",
-	"13": "Thrower",
-	"14": "Wardancer",
-	"15": "Treeman",
-
-	"16": "Lineman",
-	"17": "Thrower",
-	"18": "Gutter Runner",
-	"19": "Stormvermin",
-	"20": "Rat Ogre",
-
-	"21": "Lineman",
-	"22": "Goblin",
-	"23": "Thrower",
-	"24": "Black Orc Blocker",
-	"25": "Blitzer",
-	"26": "Troll",
-
-	"27": "Skink",
-	"28": "Saurus",
-	"29": "Kroxigor",
-
-	"32": "Beastman",
-	"33": "Chaos Warrior",
-	"34": "Minotaur",
-
-	"30":  "Goblin",
-	"31":  "Looney",
-	"44":  "Troll",
-	"45":  "Pogoer",
-	"46":  "Fanatic",
-	"107": "Bombardier",
-
-	"47": "Lineman",
-	"48": "Runner",
-	"49": "Assassin",
-	"50": "Blitzer",
-	"51": "Witch Elf",
-
-	"54": "Skeleton",
-	"55": "Zombie",
-	"56": "Ghoul",
-	"57": "Wight",
-	"58": "Mummie",
-
-	"60": "Halfling",
-	"61": "Treeman",
-
-	"62": "Lineman",
-	"63": "Trower",
-	"64": "Runner",
-	"65": "Berserker",
-	"66": "Norse Werewolf",
-	"67": "Yhetee",
-
-	"68": "Lineman",
-	"69": "Thrower",
-	"70": "Catcher",
-	"71": "Blitzer",
-
-	"72": "Lineman",
-	"73": "Thrower",
-	"74": "Catcher",
-	"75": "Blitzer",
-
-	"77": "Lineman",
-	"78": "Thrower",
-	"79": "Catcher",
-	"80": "Blitzer",
-
-	"81": "Skeleton",
-	"82": "Thro Ra",
-	"83": "Blitz Ra",
-	"84": "Tomb Guardian",
-
-	"86": "Zombie",
-	"87": "Ghoul",
-	"88": "Wight",
-	"89": "Flesh Golem",
-	"90": "Werewolf",
-
-	"94": "Beast Of Nurgle",
-	"92": "Pestigor",
-	"93": "Nurgle Warrior",
-	"91": "Rotter",
-
-	"95": "Snotling",
-	"96": "Ogre",
-
-	"97": "Thrall",
-	"98": "Vampire",
-
-	"108": "Hobgoblin",
-	"109": "Blocker",
-	"110": "Bull Centaur",
-	"111": "Minotaur",
-
-	"123": "Goblin",
-	"124": "Skaven Lineman",
-	"125": "Skaven Thrower",
-	"126": "Skaven Blitzer",
-	"127": "Warpstone Troll",
-
-	"139": "Lineman",
-	"140": "Blitzer",
-	"141": "Blocker",
-
-	"142": "Lineman",
-	"143": "Catcher",
-	"144": "Blitzer",
-	"145": "Tame Bear",
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	//go:embed mappings
+	mappingFiles embed.FS
+)
+
+var (
+	PlayerTypesMapping   = NewMapping("player_types")
+	SkillMapping         = NewMapping("skills")
+	RaceMapping          = NewMapping("races")
+	CasualtyMapping      = NewMapping("casualties")
+	ActionTypeMapping    = NewMapping("action_types")
+	RollTypeMapping      = NewMapping("roll_types")
+	BlockDiceMapping     = NewMapping("block_dice")
+	KickOffMapping       = NewMapping("kickoff")
+	EndTurnReasonMapping = NewMapping("end_turn_reasons")
+	WeatherMapping       = NewMapping("weather")
+	InducementMapping    = NewMapping("inducements")
+)
+
+var mappings = []*Mapping{
+	PlayerTypesMapping,
+	SkillMapping,
+	RaceMapping,
+	CasualtyMapping,
+	ActionTypeMapping,
+	RollTypeMapping,
+	BlockDiceMapping,
+	KickOffMapping,
+	EndTurnReasonMapping,
+	WeatherMapping,
+	InducementMapping,
+}
+
+func init() {
+	for _, m := range mappings {
+		file, err := m.loadEmbedded()
+		if err != nil {
+			panic(err)
+		}
+		m.set(file, sourceEmbedded)
+	}
+}
+
+const sourceEmbedded = "embedded"
+
+// mappingFile is the format of the files in parser/mappings and in the override directory
+type mappingFile struct {
+	Version int               `yaml:"version"`
+	IDs     map[string]string `yaml:"ids"`
+	// Effects is only used by the casualties mapping
+	Effects map[int]casualtyEffect `yaml:"effects"`
+}
+
+// Mapping translates the numeric IDs of the game into names. It's safe to use
+// while the tables are being reloaded.
+type Mapping struct {
+	mx      *sync.RWMutex
+	name    string
+	version int
+	source  string
+	modTime time.Time
+	ids     map[string]string
+	effects map[int]casualtyEffect
 }
 
-var SkillMapping = map[string]string{
-	"1":   "Strip Ball",
-	"2":   "Strength",
-	"3":   "Agility",
-	"4":   "Movement",
-	"5":   "Armor Value",
-	"6":   "Catch",
-	"7":   "Dodge",
-	"8":   "Sprint",
-	"9":   "Pass Block",
-	"10":  "Foul Appearance",
-	"11":  "Leap",
-	"12":  "Extra Arms",
-	"13":  "Mighty Blow",
-	"14":  "Leader",
-	"15":  "Horns",
-	"16":  "Two Heads",
-	"17":  "Stand Firm",
-	"18":  "Always Hungry",
-	"19":  "Regeneration",
-	"20":  "Take Root",
-	"21":  "Accurate",
-	"22":  "Break Tackle",
-	"23":  "Sneaky Git",
-	"25":  "Chainsaw",
-	"26":  "Dauntless",
-	"27":  "Dirty Player",
-	"28":  "Diving Catch",
-	"29":  "Dump Off",
-	"30":  "Block",
-	"31":  "Bone Head",
-	"32":  "Very Long Legs",
-	"33":  "Disturbing Presence",
-	"34":  "Diving Tackle",
-	"35":  "Fend",
-	"36":  "Frenzy",
-	"37":  "Grab",
-	"38":  "Guard",
-	"39":  "Hail Mary Pass",
-	"40":  "Juggernaut",
-	"41":  "Jump Up",
-	"44":  "Loner",
-	"45":  "Nerves Of Steel",
-	"46":  "No Hands",
-	"47":  "Pass",
-	"48":  "Piling On",
-	"49":  "Prehensile Tail",
-	"50":  "Pro",
-	"51":  "Really Stupid",
-	"52":  "Right Stuff",
-	"53":  "Safe Throw",
-	"54":  "Secret Weapon",
-	"55":  "Shadowing",
-	"56":  "Side Step",
-	"57":  "Tackle",
-	"58":  "Strong Arm",
-	"59":  "Stunty",
-	"60":  "Sure Feet",
-	"61":  "Sure Hands",
-	"63":  "Thick Skull",
-	"64":  "Throw Teammate",
-	"67":  "Wild Animal",
-	"68":  "Wrestle",
-	"69":  "Tentacles",
-	"70":  "Multiple Block",
-	"71":  "Kick",
-	"72":  "Kick Off Return",
-	"74":  "Big Hands",
-	"75":  "Claws",
-	"76":  "Ball n Chain",
-	"77":  "Stab",
-	"78":  "Hypnotic Gaze",
-	"80":  "Bombardier",
-	"81":  "Decay",
-	"82":  "Nurgle's Rot",
-	"84":  "Blood Lust",
-	"83":  "Titchy",
-	"86":  "Animosity",
-	"228": "Fan Favorite",
-	"264": "Stakes",
+func NewMapping(name string) *Mapping {
+	return &Mapping{
+		mx:      &sync.RWMutex{},
+		name:    name,
+		ids:     make(map[string]string),
+		effects: make(map[int]casualtyEffect),
+	}
+}
+
+func (m *Mapping) Get(id string) (string, bool) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	name, ok := m.ids[id]
+	return name, ok
 }
 
-var RaceMapping = map[string]string{
-	"1":  "Human",
-	"2":  "Dwarf",
-	"3":  "Skaven",
-	"4":  "Orc",
-	"5":  "Lizardman",
-	"6":  "Goblin",
-	"7":  "Wood_Elf",
-	"8":  "Chaos",
-	"9":  "Dark_Elf",
-	"10": "Undead",
-	"11": "Halfling",
-	"12": "Norse",
-	"13": "Amazon",
-	"14": "Elf",
-	"15": "High_Elf",
-	"16": "Khemri",
-	"17": "Necromantic",
-	"18": "Nurgle",
-	"19": "Ogre",
-	"20": "Vampire",
-	"21": "Chaos_Dwarf",
-	"22": "Underworld",
-	"24": "Bretonnia",
-	"25": "Kislev",
+// Name returns the name for a numeric ID or an empty string if it's unknown
+func (m *Mapping) Name(id int) string {
+	name, _ := m.Get(fmt.Sprint(id))
+	return name
+}
+
+// effect returns what a casualty means for the player, see the casualties mapping
+func (m *Mapping) effect(id int) (casualtyEffect, bool) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	effect, ok := m.effects[id]
+	return effect, ok
+}
+
+// Table is the name of the mapping, also used as its file name
+func (m *Mapping) Table() string {
+	return m.name
+}
+
+func (m *Mapping) Version() int {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	return m.version
+}
+
+// MappingsVersion combines the versions of every mapping in use. Versions only
+// go up, so a record stamped with a lower one was mapped with older tables.
+func MappingsVersion() int {
+	version := 0
+	for _, m := range mappings {
+		version += m.Version()
+	}
+	return version
+}
+
+func (m *Mapping) set(file mappingFile, source string) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.version = file.Version
+	m.source = source
+	m.ids = file.IDs
+	m.effects = file.Effects
+	if m.effects == nil {
+		m.effects = make(map[int]casualtyEffect)
+	}
 }
 
-var CasualtyMapping = map[string]string{
-	"1":  "Badly Hurt",
-	"2":  "Broken Ribs",
-	"3":  "Groin Strain",
-	"4":  "Gouged Eye",
-	"5":  "Broken Jaw",
-	"6":  "Fractured Arm",
-	"7":  "Fractured Leg",
-	"8":  "Smashed Hand",
-	"9":  "Pinched Nerve",
-	"10": "Damaged Back",
-	"11": "Smashed Knee",
-	"12": "Smashed Hip",
-	"13": "Smashed Ankle",
-	"14": "Serious Concussion",
-	"15": "Fractured Skull",
-	"16": "Broken Neck",
-	"17": "Smashed Collar Bone",
-	"18": "Death",
+func (m *Mapping) loadEmbedded() (mappingFile, error) {
+	var file mappingFile
+	contents, err := mappingFiles.ReadFile(fmt.Sprintf("mappings/%s.yml", m.name))
+	if err != nil {
+		return file, fmt.Errorf("Failed to read embedded mapping %s: %w", m.name, err)
+	}
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return file, fmt.Errorf("Failed to unmarshal embedded mapping %s: %w", m.name, err)
+	}
+	return file, nil
+}
+
+// reload replaces the IDs with the ones from the override directory if the file
+// changed since the last time. Files with an older version than the embedded
+// one are ignored so a forgotten override can't hide IDs added in a newer build.
+func (m *Mapping) reload(dir string) error {
+	path := filepath.Join(dir, fmt.Sprintf("%s.yml", m.name))
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return m.restoreEmbedded()
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to stat mapping file %s: %w", path, err)
+	}
+
+	m.mx.RLock()
+	unchanged := m.modTime.Equal(info.ModTime())
+	m.mx.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read mapping file %s: %w", path, err)
+	}
+
+	var file mappingFile
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return fmt.Errorf("Failed to unmarshal mapping file %s: %w", path, err)
+	}
+
+	embedded, err := m.loadEmbedded()
+	if err != nil {
+		return err
+	}
+
+	m.mx.Lock()
+	m.modTime = info.ModTime()
+	m.mx.Unlock()
+
+	loggerContext := logger.WithFields(log.Fields{
+		"path":    path,
+		"version": file.Version,
+	})
+
+	if file.Version < embedded.Version {
+		loggerContext.WithField("embedded_version", embedded.Version).Warn("Ignoring outdated mapping file")
+		return nil
+	}
+
+	// Overrides usually only add IDs, the effects they don't list are kept
+	effects := make(map[int]casualtyEffect, len(embedded.Effects)+len(file.Effects))
+	for id, effect := range embedded.Effects {
+		effects[id] = effect
+	}
+	for id, effect := range file.Effects {
+		effects[id] = effect
+	}
+	file.Effects = effects
+
+	m.set(file, path)
+	loggerContext.Info("Loaded mapping file")
+
+	return nil
+}
+
+// restoreEmbedded switches back to the embedded IDs when an override file is removed
+func (m *Mapping) restoreEmbedded() error {
+	m.mx.RLock()
+	overridden := m.source != sourceEmbedded
+	m.mx.RUnlock()
+	if !overridden {
+		return nil
+	}
+
+	file, err := m.loadEmbedded()
+	if err != nil {
+		return err
+	}
+
+	m.mx.Lock()
+	m.modTime = time.Time{}
+	m.mx.Unlock()
+
+	m.set(file, sourceEmbedded)
+	logger.WithField("mapping", m.name).Info("Mapping file removed, restored embedded mapping")
+
+	return nil
+}
+
+// ReloadMappings loads every changed mapping file from the configured mapping directory
+func ReloadMappings() error {
+	if MappingPath() == "" {
+		return nil
+	}
+
+	for _, m := range mappings {
+		if err := m.reload(MappingPath()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WatchMappings loads the mapping overrides and keeps checking them for changes until done is closed
+func WatchMappings(done <-chan struct{}) {
+	if MappingPath() == "" {
+		return
+	}
+
+	if err := ReloadMappings(); err != nil {
+		logger.WithError(err).Error("Failed to load mappings")
+	}
+
+	go func() {
+		logger.WithFields(log.Fields{
+			"path":     MappingPath(),
+			"interval": MappingReloadInterval().String(),
+		}).Debug("Watching mapping files")
+		t := time.NewTicker(MappingReloadInterval())
+		for {
+			select {
+			case <-t.C:
+				if err := ReloadMappings(); err != nil {
+					logger.WithError(err).Error("Failed to reload mappings")
+				}
+			case <-done:
+				t.Stop()
+				return
+			}
+		}
+	}()
 }
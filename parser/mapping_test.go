@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeMapping writes an override file and gives it its own modification time
+// so writes within the same second are still seen as changes
+func writeMapping(t *testing.T, dir, name, contents string, modTime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, name+".yml")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmbeddedMappings(t *testing.T) {
+	for _, m := range mappings {
+		if m.Version() < 1 {
+			t.Errorf("mapping %s has version %d", m.Table(), m.Version())
+		}
+		if len(m.ids) == 0 {
+			t.Errorf("mapping %s is empty", m.Table())
+		}
+	}
+
+	if got := RaceMapping.Name(1); got != "Human" {
+		t.Errorf("RaceMapping.Name(1) = %s, want Human", got)
+	}
+	if got := RaceMapping.Name(-1); got != "" {
+		t.Errorf("RaceMapping.Name(-1) = %s, want nothing", got)
+	}
+}
+
+func TestMappingReload(t *testing.T) {
+	dir := t.TempDir()
+	m := NewMapping("weather")
+	embedded, err := m.loadEmbedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.set(embedded, sourceEmbedded)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		prepare  func()
+		wantName string
+		version  int
+	}{
+		{
+			name:     "no override",
+			prepare:  func() {},
+			wantName: "Nice",
+			version:  embedded.Version,
+		},
+		{
+			name: "override",
+			prepare: func() {
+				writeMapping(t, dir, "weather", "version: 1\nids:\n  3: Lovely\n", now.Add(-time.Minute))
+			},
+			wantName: "Lovely",
+			version:  1,
+		},
+		{
+			name: "changed override",
+			prepare: func() {
+				writeMapping(t, dir, "weather", "version: 2\nids:\n  3: Glorious\n", now)
+			},
+			wantName: "Glorious",
+			version:  2,
+		},
+		{
+			name: "outdated override is ignored",
+			prepare: func() {
+				writeMapping(t, dir, "weather", "version: 0\nids:\n  3: Dreary\n", now.Add(time.Minute))
+			},
+			wantName: "Glorious",
+			version:  2,
+		},
+		{
+			name: "removed override restores the embedded mapping",
+			prepare: func() {
+				if err := os.Remove(filepath.Join(dir, "weather.yml")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantName: "Nice",
+			version:  embedded.Version,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare()
+			if err := m.reload(dir); err != nil {
+				t.Fatalf("reload() error = %v", err)
+			}
+			if got := m.Name(3); got != tt.wantName {
+				t.Errorf("Name(3) = %s, want %s", got, tt.wantName)
+			}
+			if got := m.Version(); got != tt.version {
+				t.Errorf("Version() = %d, want %d", got, tt.version)
+			}
+		})
+	}
+}
+
+func TestMappingReloadInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	m := NewMapping("weather")
+	writeMapping(t, dir, "weather", "ids: [", time.Now())
+
+	if err := m.reload(dir); err == nil {
+		t.Errorf("reload() error = nil, want an error for a broken file")
+	}
+}
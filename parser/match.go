@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"strings"
+	"time"
+)
+
+// timestampLayouts are the formats the match start and end times show up in
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+}
+
+// MatchInfo describes the match itself rather than either of the teams
+type MatchInfo struct {
+	Started     time.Time
+	Finished    time.Time
+	Duration    time.Duration
+	League      string
+	Competition string
+	Stadium     string
+	Turns       int
+	Resolution  Resolution
+	Weather     []WeatherChange
+	KickOffs    []KickOff
+}
+
+type WeatherChange struct {
+	Step    int
+	Turn    int
+	Weather string
+}
+
+type KickOff struct {
+	Step   int
+	Turn   int
+	Side   Side
+	Dice   []int
+	Result string
+}
+
+func newMatchInfo(stats Statistics, tl *timeline) MatchInfo {
+	info := MatchInfo{
+		Started:     parseTimestamp(stats.Started),
+		Finished:    parseTimestamp(stats.Finished),
+		League:      stats.LeagueName,
+		Competition: stats.CompetitionName,
+		Stadium:     stats.Stadium,
+		Turns:       tl.turns,
+		Resolution:  resolve(stats, tl),
+		Weather:     tl.weather,
+		KickOffs:    make([]KickOff, 0),
+	}
+
+	if !info.Started.IsZero() && info.Finished.After(info.Started) {
+		info.Duration = info.Finished.Sub(info.Started)
+	}
+
+	for _, evt := range tl.events {
+		if evt.Kind != EventKickOff {
+			continue
+		}
+		info.KickOffs = append(info.KickOffs, KickOff{
+			Step:   evt.Step,
+			Turn:   evt.Turn,
+			Side:   evt.Side,
+			Dice:   evt.Dice,
+			Result: evt.Result,
+		})
+	}
+
+	return info
+}
+
+func parseTimestamp(raw string) time.Time {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range timestampLayouts {
+		if ts, err := time.Parse(layout, raw); err == nil {
+			return ts
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMatchInfo(t *testing.T) {
+	match := parseFixture(t, "match.xml").Match
+
+	started := time.Date(2022, 3, 1, 20, 0, 0, 0, time.UTC)
+	if !match.Started.Equal(started) {
+		t.Errorf("Started = %s, want %s", match.Started, started)
+	}
+	if match.Duration != 90*time.Minute {
+		t.Errorf("Duration = %s, want 1h30m", match.Duration)
+	}
+	if match.League != "Old World League" || match.Competition != "Season 1" || match.Stadium != "Altdorf Arena" {
+		t.Errorf("League, Competition, Stadium = %s, %s, %s", match.League, match.Competition, match.Stadium)
+	}
+
+	weather := []WeatherChange{
+		{Step: 0, Turn: 0, Weather: "Nice"},
+		{Step: 3, Turn: 1, Weather: "Pouring Rain"},
+	}
+	if !reflect.DeepEqual(match.Weather, weather) {
+		t.Errorf("Weather = %+v, want %+v", match.Weather, weather)
+	}
+
+	kickOffs := []KickOff{{Step: 1, Turn: 0, Side: SideAway, Dice: []int{2, 4}, Result: "Cheering Fans"}}
+	if !reflect.DeepEqual(match.KickOffs, kickOffs) {
+		t.Errorf("KickOffs = %+v, want %+v", match.KickOffs, kickOffs)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want time.Time
+	}{
+		{"2022-03-01 20:00:00", time.Date(2022, 3, 1, 20, 0, 0, 0, time.UTC)},
+		{" 2022-03-01T20:00:00 ", time.Date(2022, 3, 1, 20, 0, 0, 0, time.UTC)},
+		{"2022-03-01T20:00:00+01:00", time.Date(2022, 3, 1, 19, 0, 0, 0, time.UTC)},
+		{"", time.Time{}},
+		{"yesterday", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		if got := parseTimestamp(tt.raw); !got.Equal(tt.want) {
+			t.Errorf("parseTimestamp(%q) = %s, want %s", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestMatchDurationNeedsBothTimes(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats Statistics
+	}{
+		{"no start", Statistics{Finished: "2022-03-01 21:30:00"}},
+		{"finished before it started", Statistics{Started: "2022-03-01 21:30:00", Finished: "2022-03-01 20:00:00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if info := newMatchInfo(tt.stats, newTimeline()); info.Duration != 0 {
+				t.Errorf("Duration = %s, want 0", info.Duration)
+			}
+		})
+	}
+}
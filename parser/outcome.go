@@ -0,0 +1,93 @@
+package parser
+
+// Outcome is the result of the match from the point of view of one team
+type Outcome string
+
+const (
+	OutcomeWin      Outcome = "win"
+	OutcomeDraw     Outcome = "draw"
+	OutcomeLoss     Outcome = "loss"
+	OutcomeConceded Outcome = "conceded"
+	OutcomeForfeit  Outcome = "forfeit"
+)
+
+// Ending describes how the match came to an end
+type Ending string
+
+const (
+	EndingNormal     Ending = "normal"
+	EndingConcession Ending = "concession"
+	EndingDisconnect Ending = "disconnect"
+	EndingAdmin      Ending = "admin"
+)
+
+// Raw values and limits used to tell apart the ways a match can end
+const (
+	endTurnReasonTimeout = 5
+
+	// regularTurns is the number of turns a team plays in a match without overtime
+	regularTurns = 16
+)
+
+// Resolution tells how the match ended and, unless it ended normally, which
+// side conceded, disconnected or lost by the decision of an admin and when
+type Resolution struct {
+	Ending Ending
+	Side   Side
+	Turn   int
+}
+
+// resolve works out how the match ended from what's left in the replay:
+//
+//   - A team that conceded has the cash it earned before conceding recorded, while
+//     a team that played the match out never has.
+//   - A match that stopped before the last turn because a turn ran out of time
+//     means the coach of the playing team disconnected.
+//   - A finished match without a single turn played had its result set by an admin.
+func resolve(stats Statistics, tl *timeline) Resolution {
+	switch {
+	case stats.HomeCashEarnedBeforeConcession > 0:
+		return Resolution{Ending: EndingConcession, Side: SideHome, Turn: tl.sideTurns[SideHome]}
+	case stats.AwayCashEarnedBeforeConcession > 0:
+		return Resolution{Ending: EndingConcession, Side: SideAway, Turn: tl.sideTurns[SideAway]}
+	case tl.lastEndTurn != nil && tl.lastEndTurn.Reason == endTurnReasonTimeout && tl.turns < regularTurns:
+		side := sideFromIndex(tl.lastEndTurn.PlayingTeam)
+		return Resolution{Ending: EndingDisconnect, Side: side, Turn: tl.sideTurns[side]}
+	case tl.turns == 0:
+		side := SideUnknown
+		if stats.HomeScore < stats.AwayScore {
+			side = SideHome
+		} else if stats.AwayScore < stats.HomeScore {
+			side = SideAway
+		}
+		return Resolution{Ending: EndingAdmin, Side: side}
+	}
+
+	return Resolution{Ending: EndingNormal}
+}
+
+// outcomes turns the resolution and the score into the outcome for both teams
+func outcomes(res Resolution, homeScore, awayScore int) (Outcome, Outcome) {
+	switch res.Ending {
+	case EndingConcession:
+		if res.Side == SideHome {
+			return OutcomeConceded, OutcomeWin
+		}
+		return OutcomeWin, OutcomeConceded
+	case EndingDisconnect, EndingAdmin:
+		switch res.Side {
+		case SideHome:
+			return OutcomeForfeit, OutcomeWin
+		case SideAway:
+			return OutcomeWin, OutcomeForfeit
+		}
+	}
+
+	switch {
+	case homeScore > awayScore:
+		return OutcomeWin, OutcomeLoss
+	case homeScore < awayScore:
+		return OutcomeLoss, OutcomeWin
+	}
+	return OutcomeDraw, OutcomeDraw
+}
@@ -0,0 +1,124 @@
+package parser
+
+import "testing"
+
+func TestOutcomeFromReplay(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		resolution Resolution
+		home       Outcome
+		away       Outcome
+	}{
+		{"match.xml", Resolution{Ending: EndingNormal}, OutcomeWin, OutcomeLoss},
+		{"conceded.xml", Resolution{Ending: EndingConcession, Side: SideAway, Turn: 1}, OutcomeWin, OutcomeConceded},
+		{"disconnect.xml", Resolution{Ending: EndingDisconnect, Side: SideAway, Turn: 2}, OutcomeWin, OutcomeForfeit},
+		{"admin.xml", Resolution{Ending: EndingAdmin, Side: SideHome}, OutcomeForfeit, OutcomeWin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			record := parseFixture(t, tt.fixture)
+			if record.Match.Resolution != tt.resolution {
+				t.Errorf("Resolution = %+v, want %+v", record.Match.Resolution, tt.resolution)
+			}
+			if record.Home.Outcome != tt.home || record.Away.Outcome != tt.away {
+				t.Errorf("Outcome = %s, %s, want %s, %s", record.Home.Outcome, record.Away.Outcome, tt.home, tt.away)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	played := func(turns int, lastEndTurn *RulesEventEndTurn) *timeline {
+		tl := newTimeline()
+		tl.turns = turns
+		tl.sideTurns[SideHome] = turns
+		tl.sideTurns[SideAway] = turns
+		tl.lastEndTurn = lastEndTurn
+		return tl
+	}
+
+	tests := []struct {
+		name  string
+		stats Statistics
+		tl    *timeline
+		want  Resolution
+	}{
+		{
+			name:  "played to the end",
+			stats: Statistics{HomeScore: 2, AwayScore: 1},
+			tl:    played(16, &RulesEventEndTurn{PlayingTeam: 1, Reason: 4}),
+			want:  Resolution{Ending: EndingNormal},
+		},
+		{
+			name:  "home conceded",
+			stats: Statistics{HomeCashEarnedBeforeConcession: 10000},
+			tl:    played(5, &RulesEventEndTurn{PlayingTeam: 0, Reason: 1}),
+			want:  Resolution{Ending: EndingConcession, Side: SideHome, Turn: 5},
+		},
+		{
+			name:  "concession wins over a timeout",
+			stats: Statistics{AwayCashEarnedBeforeConcession: 10000},
+			tl:    played(5, &RulesEventEndTurn{PlayingTeam: 0, Reason: endTurnReasonTimeout}),
+			want:  Resolution{Ending: EndingConcession, Side: SideAway, Turn: 5},
+		},
+		{
+			name: "home timed out before the last turn",
+			tl:   played(9, &RulesEventEndTurn{PlayingTeam: 0, Reason: endTurnReasonTimeout}),
+			want: Resolution{Ending: EndingDisconnect, Side: SideHome, Turn: 9},
+		},
+		{
+			name:  "timeout in the last turn ends the match normally",
+			stats: Statistics{HomeScore: 1},
+			tl:    played(16, &RulesEventEndTurn{PlayingTeam: 1, Reason: endTurnReasonTimeout}),
+			want:  Resolution{Ending: EndingNormal},
+		},
+		{
+			name:  "admin decision without a winner",
+			stats: Statistics{},
+			tl:    played(0, nil),
+			want:  Resolution{Ending: EndingAdmin, Side: SideUnknown},
+		},
+		{
+			name:  "admin decision for the home team",
+			stats: Statistics{HomeScore: 2},
+			tl:    played(0, nil),
+			want:  Resolution{Ending: EndingAdmin, Side: SideAway},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolve(tt.stats, tt.tl); got != tt.want {
+				t.Errorf("resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutcomes(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution Resolution
+		homeScore  int
+		awayScore  int
+		home       Outcome
+		away       Outcome
+	}{
+		{"home wins", Resolution{Ending: EndingNormal}, 2, 1, OutcomeWin, OutcomeLoss},
+		{"away wins", Resolution{Ending: EndingNormal}, 0, 1, OutcomeLoss, OutcomeWin},
+		{"draw", Resolution{Ending: EndingNormal}, 1, 1, OutcomeDraw, OutcomeDraw},
+		{"conceding team loses even when ahead", Resolution{Ending: EndingConcession, Side: SideHome}, 2, 0, OutcomeConceded, OutcomeWin},
+		{"away forfeits", Resolution{Ending: EndingDisconnect, Side: SideAway}, 1, 1, OutcomeWin, OutcomeForfeit},
+		{"admin decision without a side is scored", Resolution{Ending: EndingAdmin}, 0, 0, OutcomeDraw, OutcomeDraw},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home, away := outcomes(tt.resolution, tt.homeScore, tt.awayScore)
+			if home != tt.home || away != tt.away {
+				t.Errorf("outcomes() = %s, %s, want %s, %s", home, away, tt.home, tt.away)
+			}
+		})
+	}
+}
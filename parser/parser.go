@@ -1,10 +1,10 @@
 package parser
 
 import (
+	"crypto/sha256"
 	"encoding/xml"
 	"fmt"
 	"io"
-	"strings"
 )
 
 type Replay struct {
@@ -12,7 +12,64 @@ type Replay struct {
 }
 
 type ReplayStep struct {
-	RulesEventGameFinished RulesEventGameFinished
+	BoardState                 BoardState
+	RulesEventBoardAction      []RulesEventBoardAction
+	RulesEventKickOffTable     *RulesEventKickOffTable
+	RulesEventEndTurn          *RulesEventEndTurn
+	RulesEventInducementsInfos *RulesEventInducementsInfos
+	RulesEventGameFinished     *RulesEventGameFinished
+}
+
+type BoardState struct {
+	CurrentTeam int         `xml:"CurrentTeamId"`
+	Weather     int         `xml:"Meteo"`
+	Teams       []TeamState `xml:"ListTeams>TeamState"`
+}
+
+type TeamState struct {
+	Name      string `xml:"Data>Name"`
+	Race      Race   `xml:"Data>IdRace"`
+	Value     int    `xml:"Data>Value"`
+	GameTurn  int
+	Touchdown int
+	Players   []PlayerState `xml:"ListPitchPlayers>PlayerState"`
+}
+
+type PlayerState struct {
+	ID       int    `xml:"Id"`
+	Name     string `xml:"Data>Name"`
+	Type     string `xml:"Data>IdPlayerTypes"`
+	Movement int    `xml:"Data>Ma"`
+	Agility  int    `xml:"Data>Ag"`
+	Armor    int    `xml:"Data>Av"`
+	Strength int    `xml:"Data>St"`
+	Skills   string `xml:"Data>ListSkills"`
+}
+
+type RulesEventBoardAction struct {
+	PlayerID   int `xml:"PlayerId"`
+	ActionType int
+	Results    []BoardActionResult `xml:"Results>BoardActionResult"`
+}
+
+type BoardActionResult struct {
+	RollType    int
+	ResultType  int
+	Requirement int
+	RollStatus  int
+	Dice        string `xml:"CoachChoices>ListDices"`
+	// Chooser is the team that picks the block die, nil if the replay doesn't say
+	Chooser *int `xml:"CoachChoices>ConcernedTeam"`
+}
+
+type RulesEventKickOffTable struct {
+	Event int
+	Dice  string `xml:"ListDices"`
+}
+
+type RulesEventEndTurn struct {
+	PlayingTeam int
+	Reason      int
 }
 
 type RulesEventGameFinished struct {
@@ -40,13 +97,14 @@ type TeamResult struct {
 }
 
 type PlayerResult struct {
+	ID                  int
 	Name                string
-	Type                string
+	Type                GameID
 	Movement            int
 	Agility             int
 	Armor               int
 	Strength            int
-	Skills              []string
+	Skills              []GameID
 	XP                  int
 	InflictedTackles    int
 	SustainedTackles    int
@@ -54,11 +112,24 @@ type PlayerResult struct {
 	SustainedInjuries   int
 	InflictedCasualties int
 	SustainedCasualties int
+	Touchdowns          int
+	Completions         int
+	Catches             int
+	Interceptions       int
+	MetersRun           int
+	MetersPassed        int
 	MVP                 bool
-	Casualties          []string
+	StarPlayer          bool
+	Mercenary           bool
+	Casualties          []GameID
+	LastingInjuries     []GameID
+	MissedMatch         bool
+	SPP                 SPP
+	Advancement         Advancement
 }
 
 type rawPlayerData struct {
+	ID                  int    `xml:"PlayerData>Id"`
 	Name                string `xml:"PlayerData>Name"`
 	Type                string `xml:"PlayerData>IdPlayerTypes"`
 	Movement            int    `xml:"PlayerData>Ma"`
@@ -66,6 +137,12 @@ type rawPlayerData struct {
 	Armor               int    `xml:"PlayerData>Av"`
 	Strength            int    `xml:"PlayerData>St"`
 	Skills              string `xml:"PlayerData>ListSkills"`
+	Experience          int    `xml:"PlayerData>Experience"`
+	Level               int    `xml:"PlayerData>Level"`
+	StarPlayer          int    `xml:"PlayerData>IsStar"`
+	Mercenary           int    `xml:"PlayerData>IsMercenary"`
+	LastingInjuries     string `xml:"PlayerData>ListCasualties"`
+	MissedMatch         int    `xml:"PlayerData>MatchSuspended"`
 	XP                  int    `xml:"Xp"`
 	InflictedTackles    int    `xml:"Statistics>InflictedTackles"`
 	SustainedTackles    int    `xml:"Statistics>SustainedTackles"`
@@ -73,12 +150,20 @@ type rawPlayerData struct {
 	SustainedInjuries   int    `xml:"Statistics>SustainedInjuries"`
 	InflictedCasualties int    `xml:"Statistics>InflictedCasualties"`
 	SustainedCasualties int    `xml:"Statistics>SustainedCasualties"`
+	Touchdowns          int    `xml:"Statistics>InflictedTouchdowns"`
+	Completions         int    `xml:"Statistics>InflictedPasses"`
+	Catches             int    `xml:"Statistics>InflictedCatches"`
+	Interceptions       int    `xml:"Statistics>InflictedInterceptions"`
+	MetersRun           int    `xml:"Statistics>InflictedMetersRunning"`
+	MetersPassed        int    `xml:"Statistics>InflictedMetersPassing"`
 	MVP                 int    `xml:"Statistics>MVP"`
 	Casualty1           int
 	Casualty2           int
 }
 
-type Race string
+type Race struct {
+	GameID
+}
 
 func (r *Race) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	var rr string
@@ -86,10 +171,7 @@ func (r *Race) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 		return fmt.Errorf("Failed to decode element: %w", err)
 	}
 
-	if race, ok := RaceMapping[rr]; ok {
-		rc := Race(race)
-		*r = rc
-	}
+	r.GameID = parseGameID(RaceMapping, rr)
 	return nil
 }
 
@@ -99,10 +181,9 @@ func (ps *PlayerResult) UnmarshalXML(d *xml.Decoder, start xml.StartElement) err
 		return fmt.Errorf("Failed to decode element: %w", err)
 	}
 
+	ps.ID = raw.ID
 	ps.Name = raw.Name
-	if tp, ok := PlayerTypesMapping[raw.Type]; ok {
-		ps.Type = tp
-	}
+	ps.Type = parseGameID(PlayerTypesMapping, raw.Type)
 	ps.Movement = raw.Movement
 	ps.Agility = raw.Agility
 	ps.Armor = raw.Armor
@@ -114,32 +195,51 @@ func (ps *PlayerResult) UnmarshalXML(d *xml.Decoder, start xml.StartElement) err
 	ps.SustainedTackles = raw.SustainedTackles
 	ps.InflictedCasualties = raw.InflictedCasualties
 	ps.SustainedCasualties = raw.SustainedCasualties
+	ps.Touchdowns = raw.Touchdowns
+	ps.Completions = raw.Completions
+	ps.Catches = raw.Catches
+	ps.Interceptions = raw.Interceptions
+	ps.MetersRun = raw.MetersRun
+	ps.MetersPassed = raw.MetersPassed
 
 	ps.MVP = raw.MVP == 1
+	ps.StarPlayer = raw.StarPlayer == 1
+	ps.Mercenary = raw.Mercenary == 1
+	ps.MissedMatch = raw.MissedMatch == 1
 
-	ps.Casualties = make([]string, 0)
+	ps.SPP = newSPP(ps.Touchdowns, ps.Completions, ps.Interceptions, ps.InflictedCasualties, ps.MVP)
+	// Star players and mercenaries only play this one match so they don't advance
+	if !ps.StarPlayer && !ps.Mercenary {
+		ps.Advancement = newAdvancement(raw.Experience, raw.Level, ps.XP)
+	}
+
+	ps.Casualties = make([]GameID, 0)
 	if raw.Casualty1 != 0 {
-		ps.Casualties = append(ps.Casualties, CasualtyMapping[fmt.Sprint(raw.Casualty1)])
+		ps.Casualties = append(ps.Casualties, NewGameID(CasualtyMapping, raw.Casualty1))
 	}
 	if raw.Casualty2 != 0 {
-		ps.Casualties = append(ps.Casualties, CasualtyMapping[fmt.Sprint(raw.Casualty2)])
+		ps.Casualties = append(ps.Casualties, NewGameID(CasualtyMapping, raw.Casualty2))
+	}
+
+	ps.LastingInjuries = make([]GameID, 0)
+	if raw.LastingInjuries != "" {
+		ps.LastingInjuries = parseIDList(CasualtyMapping, raw.LastingInjuries)
 	}
 
 	if raw.Skills != "" {
-		skills := strings.Split(strings.Trim(raw.Skills, "()"), ",")
-		skillList := make([]string, 0)
-		for _, skill := range skills {
-			if skillName, ok := SkillMapping[skill]; ok {
-				skillList = append(skillList, skillName)
-			}
-		}
-		ps.Skills = skillList
+		ps.Skills = parseIDList(SkillMapping, raw.Skills)
 	}
 
 	return nil
 }
 
 type Statistics struct {
+	IdMatch                        string
+	Started                        string
+	Finished                       string
+	LeagueName                     string
+	CompetitionName                string
+	Stadium                        string
 	HomeInflictedInjuries          int
 	AwayInflictedInjuries          int
 	HomeSustainedKO                int
@@ -192,15 +292,47 @@ type Statistics struct {
 	AwayNbSupporters               int
 }
 
+// Version is stamped on every record. Bump it whenever a change to the parser
+// changes what ends up in the records so the stored replays can be reprocessed.
+const Version = 1
+
+// Options change how strict the parser is
+type Options struct {
+	// Lenient salvages whatever can be read from a broken or truncated replay
+	// instead of failing, the record is flagged as partial in that case
+	Lenient bool
+}
+
 func Parse(r io.Reader) (Record, error) {
-	var rr Replay
-	decoder := xml.NewDecoder(r)
-	err := decoder.Decode(&rr)
-	if err != nil {
-		return Record{}, fmt.Errorf("Failed to decode element: %w", err)
+	return ParseWithOptions(r, Options{})
+}
+
+func ParseWithOptions(r io.Reader, opts Options) (Record, error) {
+	builder := newRecordBuilder()
+	builder.content = sha256.New()
+	header, err := Stream(io.TeeReader(r, builder.content), func(idx int, step ReplayStep) error {
+		builder.add(idx, step)
+		return nil
+	})
+	if err != nil && !opts.Lenient {
+		return Record{}, err
 	}
 
-	record := NewRecordFromReplay(rr)
+	var record Record
+	if err != nil {
+		record, err = builder.salvage(err)
+	} else {
+		record, err = builder.build()
+		if err != nil && opts.Lenient {
+			record, err = builder.salvage(err)
+		}
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	record.FormatVersion = header.ClientVersion
+	record.ParserVersion = Version
+	record.MappingVersion = MappingsVersion()
 
 	return record, nil
 }
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// EndingIncomplete is used for partial records, the replay stops before it's known how the match ended
+const EndingIncomplete Ending = "incomplete"
+
+// salvage builds a record out of whatever was read before the replay broke off.
+// If the final results made it into the replay they're used as they are,
+// otherwise the teams and rosters are taken from the last known board state.
+func (b *recordBuilder) salvage(reason error) (Record, error) {
+	if b.steps == 0 {
+		return Record{}, reason
+	}
+
+	record, err := b.build()
+	if err != nil {
+		if len(b.board.Teams) != 2 {
+			return Record{}, reason
+		}
+
+		home := teamFromState(b.board.Teams[0])
+		away := teamFromState(b.board.Teams[1])
+		record = b.record(Statistics{}, home, away)
+
+		record.Match.Resolution = Resolution{Ending: EndingIncomplete}
+		record.Home.Outcome = ""
+		record.Away.Outcome = ""
+	}
+
+	record.Partial = true
+	record.PartialReason = reason.Error()
+
+	return record, nil
+}
+
+func teamFromState(state TeamState) TeamStats {
+	team := TeamStats{
+		Name:                state.Name,
+		Race:                state.Race,
+		Value:               state.Value,
+		Score:               state.Touchdown,
+		InflictedTouchdowns: state.Touchdown,
+		PlayerResults:       make([]PlayerResult, 0, len(state.Players)),
+	}
+
+	for _, player := range state.Players {
+		result := PlayerResult{
+			ID:         player.ID,
+			Name:       player.Name,
+			Type:       parseGameID(PlayerTypesMapping, player.Type),
+			Movement:   player.Movement,
+			Agility:    player.Agility,
+			Armor:      player.Armor,
+			Strength:   player.Strength,
+			Skills:     make([]GameID, 0),
+			Casualties: make([]GameID, 0),
+
+			LastingInjuries: make([]GameID, 0),
+		}
+		if player.Skills != "" {
+			result.Skills = parseIDList(SkillMapping, player.Skills)
+		}
+		team.PlayerResults = append(team.PlayerResults, result)
+	}
+
+	return team
+}
+
+// Local file header of a zip entry, see section 4.3.7 of the zip specification
+const (
+	zipLocalHeaderSize       = 30
+	zipLocalHeaderMethod     = 8
+	zipLocalHeaderNameLength = 26
+)
+
+// openTruncatedZip reads the first entry of a zip file straight from its local
+// header. A cut off upload loses the central directory at the end of the file
+// which zip.NewReader can't do without, but the entry itself is still readable
+// up to the point where the file ends.
+func openTruncatedZip(r io.ReaderAt, size int64) (io.ReadCloser, error) {
+	header := make([]byte, zipLocalHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("Failed to read local file header: %w", err)
+	}
+	if !bytes.HasPrefix(header, []byte("PK\x03\x04")) {
+		return nil, fmt.Errorf("Missing local file header")
+	}
+
+	method := binary.LittleEndian.Uint16(header[zipLocalHeaderMethod:])
+	nameLength := binary.LittleEndian.Uint16(header[zipLocalHeaderNameLength:])
+	extraLength := binary.LittleEndian.Uint16(header[zipLocalHeaderNameLength+2:])
+	offset := int64(zipLocalHeaderSize) + int64(nameLength) + int64(extraLength)
+	if offset > size {
+		return nil, fmt.Errorf("Local file header is cut short")
+	}
+
+	data := io.NewSectionReader(r, offset, size-offset)
+	switch method {
+	case zip.Store:
+		return io.NopCloser(data), nil
+	case zip.Deflate:
+		return flate.NewReader(data), nil
+	}
+
+	return nil, fmt.Errorf("Unsupported compression method %d", method)
+}
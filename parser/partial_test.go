@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLenientParse(t *testing.T) {
+	match := readFixture(t, "match.xml")
+	finished := bytes.Index(match, []byte("  <ReplayStep>\n    <RulesEventGameFinished>"))
+	dodge := bytes.Index(match, []byte("<PlayerId>12</PlayerId>"))
+	// Cut off in the middle of the first coach's player results
+	results := bytes.Index(match, []byte("<Xp>8</Xp>"))
+
+	tests := []struct {
+		name    string
+		file    []byte
+		reason  ErrorKind
+		home    string
+		score   int
+		players int
+		ending  Ending
+	}{
+		{
+			name:    "cut off during the match",
+			file:    match[:dodge],
+			reason:  KindXMLSyntax,
+			home:    "Reikland Reavers",
+			players: 2,
+			ending:  EndingIncomplete,
+		},
+		{
+			name:    "missing game finished",
+			file:    append(append([]byte{}, match[:finished]...), []byte("</Replay>")...),
+			reason:  KindMissingGameFinished,
+			home:    "Reikland Reavers",
+			score:   1,
+			players: 2,
+			ending:  EndingIncomplete,
+		},
+		{
+			name:    "cut off in the results",
+			file:    match[:results],
+			reason:  KindXMLSyntax,
+			home:    "Reikland Reavers",
+			score:   1,
+			players: 2,
+			ending:  EndingIncomplete,
+		},
+		{
+			name:    "truncated bbrz",
+			file:    truncated(zipped(t, match[:dodge])),
+			reason:  KindXMLSyntax,
+			home:    "Reikland Reavers",
+			players: 2,
+			ending:  EndingIncomplete,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseFile(bytes.NewReader(tt.file), int64(len(tt.file))); err == nil {
+				t.Fatalf("ParseFile() without Lenient succeeded")
+			}
+
+			record, err := ParseFileWithOptions(bytes.NewReader(tt.file), int64(len(tt.file)), Options{Lenient: true})
+			if err != nil {
+				t.Fatalf("ParseFileWithOptions() error = %v", err)
+			}
+			if !record.Partial {
+				t.Errorf("Partial = false")
+			}
+			if !strings.HasPrefix(record.PartialReason, string(tt.reason)) {
+				t.Errorf("PartialReason = %s, want %s", record.PartialReason, tt.reason)
+			}
+			if record.Home.Name != tt.home || record.Home.Score != tt.score {
+				t.Errorf("Home = %s %d, want %s %d", record.Home.Name, record.Home.Score, tt.home, tt.score)
+			}
+			if len(record.Home.PlayerResults) != tt.players {
+				t.Errorf("Home has %d players, want %d", len(record.Home.PlayerResults), tt.players)
+			}
+			if record.Match.Resolution.Ending != tt.ending || record.Home.Outcome != "" {
+				t.Errorf("Resolution = %+v, Outcome = %s, want %s without an outcome", record.Match.Resolution, record.Home.Outcome, tt.ending)
+			}
+			if record.ParserVersion != Version {
+				t.Errorf("ParserVersion = %d, want %d", record.ParserVersion, Version)
+			}
+		})
+	}
+}
+
+// truncated drops the end of a file the way an interrupted upload would
+func truncated(file []byte) []byte {
+	return file[:len(file)-30]
+}
+
+func TestLenientParseKeepsFinishedResults(t *testing.T) {
+	record, err := ParseWithOptions(bytes.NewReader(readFixture(t, "match.xml")), Options{Lenient: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions() error = %v", err)
+	}
+	if record.Partial {
+		t.Errorf("Partial = true for a complete replay")
+	}
+}
+
+func TestLenientParseNothingToSalvage(t *testing.T) {
+	tests := []struct {
+		name   string
+		replay string
+		err    error
+	}{
+		{"no steps", "<Replay></Replay>", ErrNoSteps},
+		{"no board state", "<Replay><ReplayStep></ReplayStep>", ErrXMLSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseWithOptions(strings.NewReader(tt.replay), Options{Lenient: true})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("ParseWithOptions() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
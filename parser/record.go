@@ -1,15 +1,39 @@
 package parser
 
 import (
+	"crypto/sha256"
+	"encoding/xml"
 	"fmt"
+	"hash"
+	"sort"
 
 	"github.com/google/uuid"
 )
 
 type Record struct {
-	ID   uuid.UUID
-	Home TeamStats
-	Away TeamStats
+	ID       uuid.UUID
+	SeriesID uuid.UUID
+	MatchID  string
+	// ContentHash is the SHA-256 of the replay XML after it was taken out of
+	// its container, so the same replay in a .bbrz or gzipped has the same hash.
+	// It differs from the blob store key in Original, which hashes the file as uploaded.
+	ContentHash string
+	// Original is the blob store key of the file the record was parsed from
+	Original      string
+	Format        string
+	FormatVersion string
+	// ParserVersion is the Version of the parser that created the record
+	ParserVersion int
+	// MappingVersion is the MappingsVersion of the ID mappings the record was created with
+	MappingVersion int
+	Partial        bool
+	PartialReason  string
+	Match          MatchInfo
+	Home           TeamStats
+	Away           TeamStats
+	Timeline       []Event
+	Rolls          []DiceRoll
+	Unmapped       []UnmappedID
 }
 
 type TeamStats struct {
@@ -36,6 +60,7 @@ type TeamStats struct {
 	SustainedTackles           int
 	InflictedMetersRunning     int
 	MVP                        string
+	Outcome                    Outcome
 	PopularityGain             int
 	InflictedTouchdowns        int
 	SustainedCasualties        int
@@ -43,12 +68,95 @@ type TeamStats struct {
 	CashEarned                 int
 	InflictedKO                int
 	NbSupporters               int
+	Luck                       Luck
+	Inducements                Inducements
+	RosterBefore               []RosterEntry
+	RosterAfter                []RosterEntry
+	RosterChanges              RosterChanges
 
 	PlayerResults []PlayerResult
 }
 
-func NewRecordFromReplay(replay Replay) Record {
-	finished := replay.ReplaySteps[len(replay.ReplaySteps)-1].RulesEventGameFinished
+func NewRecordFromReplay(replay Replay) (Record, error) {
+	builder := newRecordBuilder()
+	// There's no raw replay to hash so the ID falls back to the decoded steps
+	builder.stepHash = sha256.New()
+	encoder := xml.NewEncoder(builder.stepHash)
+	for idx, step := range replay.ReplaySteps {
+		if err := encoder.Encode(step); err != nil {
+			return Record{}, newError(KindXMLSyntax, err)
+		}
+		builder.add(idx, step)
+	}
+
+	return builder.build()
+}
+
+// recordBuilder collects what the record needs from the replay one step at a
+// time so the steps themselves don't have to be kept around
+type recordBuilder struct {
+	timeline     *timeline
+	steps        int
+	finished     *RulesEventGameFinished
+	finishedStep int
+	// board is the last known state of the teams, used to salvage partial replays
+	board BoardState
+	// inducements are indexed the same way as the teams, home first
+	inducements [2]*TeamInducements
+	// initialPlayers are the players as they were when they were first seen on the board
+	initialPlayers map[int]PlayerState
+	// content is fed the raw replay by Parse, it's nil when the record
+	// is built from an already decoded Replay
+	content hash.Hash
+	// stepHash is fed the decoded steps instead when there's no raw replay
+	stepHash hash.Hash
+}
+
+func newRecordBuilder() *recordBuilder {
+	return &recordBuilder{
+		timeline:       newTimeline(),
+		initialPlayers: make(map[int]PlayerState),
+	}
+}
+
+func (b *recordBuilder) add(idx int, step ReplayStep) {
+	b.timeline.add(idx, step)
+	b.steps++
+	if len(step.BoardState.Teams) > 0 {
+		b.board = step.BoardState
+		b.trackPlayers(step.BoardState)
+	}
+	if step.RulesEventInducementsInfos != nil {
+		for i, team := range step.RulesEventInducementsInfos.Teams {
+			if team.TeamID >= 0 && team.TeamID < len(b.inducements) {
+				b.inducements[team.TeamID] = &step.RulesEventInducementsInfos.Teams[i]
+			}
+		}
+	}
+	if step.RulesEventGameFinished != nil {
+		b.finished = step.RulesEventGameFinished
+		b.finishedStep = idx
+	}
+}
+
+func (b *recordBuilder) build() (Record, error) {
+	if b.steps == 0 {
+		return Record{}, ErrNoSteps
+	}
+
+	if b.finished == nil {
+		err := newError(KindMissingGameFinished, nil)
+		err.Step = b.steps - 1
+		return Record{}, err
+	}
+
+	if len(b.finished.Coaches) != 2 {
+		err := newError(KindCoachCount, fmt.Errorf("Expected 2 coaches, found %d", len(b.finished.Coaches)))
+		err.Step = b.finishedStep
+		return Record{}, err
+	}
+
+	finished := b.finished
 	stats := finished.Statistics
 	homeTeam := finished.Coaches[0].TeamResult
 	awayTeam := finished.Coaches[1].TeamResult
@@ -131,11 +239,65 @@ func NewRecordFromReplay(replay Replay) Record {
 		}
 	}
 
-	id := uuid.NewSHA1(uuid.NameSpaceDNS, []byte(fmt.Sprintf("%s-%s:%s-%s", home.Name, home.CoachName, away.Name, away.CoachName)))
+	return b.record(stats, home, away), nil
+}
+
+// record fills in everything that's derived from the timeline and puts the record together
+func (b *recordBuilder) record(stats Statistics, home, away TeamStats) Record {
+	tl := b.timeline
+	b.skillsGained(&home)
+	b.skillsGained(&away)
+	home.Inducements = newInducements(b.inducements[0], home.PlayerResults)
+	away.Inducements = newInducements(b.inducements[1], away.PlayerResults)
+	b.rosters(&home)
+	b.rosters(&away)
+
+	for _, roll := range tl.rolls {
+		switch roll.Side {
+		case SideHome:
+			home.Luck.Add(roll)
+		case SideAway:
+			away.Luck.Add(roll)
+		}
+	}
+
+	match := newMatchInfo(stats, tl)
+	home.Outcome, away.Outcome = outcomes(match.Resolution, home.Score, away.Score)
+
+	contentHash := ""
+	if b.content != nil {
+		contentHash = fmt.Sprintf("%x", b.content.Sum(nil))
+	}
+	id := b.recordID(stats, contentHash)
 
 	return Record{
-		ID:   id,
-		Home: home,
-		Away: away,
+		ID:          id,
+		SeriesID:    NewSeriesID(home.Name, away.Name),
+		MatchID:     stats.IdMatch,
+		ContentHash: contentHash,
+		Match:       match,
+		Home:        home,
+		Away:        away,
+		Timeline:    tl.events,
+		Rolls:       tl.rolls,
+		Unmapped:    findUnmapped(home, away),
+	}
+}
+
+// recordID derives the ID from the match and the content of the replay. Every
+// replay has one or the other, a record built from decoded steps uses their
+// hash in place of the content hash.
+func (b *recordBuilder) recordID(stats Statistics, contentHash string) uuid.UUID {
+	if contentHash == "" && b.stepHash != nil {
+		contentHash = fmt.Sprintf("steps:%x", b.stepHash.Sum(nil))
 	}
+	return uuid.NewSHA1(uuid.NameSpaceDNS, []byte(fmt.Sprintf("%s|%s|%s|%s", stats.IdMatch, stats.Started, stats.Finished, contentHash)))
+}
+
+// NewSeriesID links every match played between the same two teams, no matter
+// which one of them was the home team
+func NewSeriesID(team1, team2 string) uuid.UUID {
+	teams := []string{team1, team2}
+	sort.Strings(teams)
+	return uuid.NewSHA1(uuid.NameSpaceDNS, []byte(fmt.Sprintf("%s:%s", teams[0], teams[1])))
 }
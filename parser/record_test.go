@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// readFixture returns the contents of a file in testdata
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("Failed to read fixture %s: %v", name, err)
+	}
+	return data
+}
+
+// parseFixture parses a replay in testdata the way uploads are parsed
+func parseFixture(t *testing.T, name string) Record {
+	t.Helper()
+	data := readFixture(t, name)
+	record, err := ParseFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to parse fixture %s: %v", name, err)
+	}
+	return record
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("replay.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRecordIDSameForEveryFormat(t *testing.T) {
+	data := readFixture(t, "match.xml")
+	want := sha256.Sum256(data)
+
+	tests := []struct {
+		format string
+		file   []byte
+	}{
+		{"xml", data},
+		{"gzip", gzipped(t, data)},
+		{"bbrz", zipped(t, data)},
+	}
+
+	var id uuid.UUID
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			record, err := ParseFile(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if err != nil {
+				t.Fatalf("ParseFile() error = %v", err)
+			}
+			if record.Format != tt.format {
+				t.Errorf("Format = %s, want %s", record.Format, tt.format)
+			}
+			if record.ContentHash != fmt.Sprintf("%x", want) {
+				t.Errorf("ContentHash = %s, want the hash of the XML", record.ContentHash)
+			}
+			if tt.format != "xml" && record.ContentHash == fmt.Sprintf("%x", sha256.Sum256(tt.file)) {
+				t.Errorf("ContentHash is the hash of the file as uploaded")
+			}
+			if id == uuid.Nil {
+				id = record.ID
+			} else if record.ID != id {
+				t.Errorf("ID = %s, want %s", record.ID, id)
+			}
+		})
+	}
+}
+
+func TestNewRecordFromReplayID(t *testing.T) {
+	// Without the match ID and times the ID depends on the steps alone
+	finished := ReplayStep{RulesEventGameFinished: &RulesEventGameFinished{
+		Coaches: []CoachResult{{}, {}},
+	}}
+	turn := func(n int) ReplayStep {
+		return ReplayStep{BoardState: BoardState{Teams: []TeamState{{GameTurn: n}, {GameTurn: n}}}}
+	}
+
+	build := func(steps ...ReplayStep) Record {
+		t.Helper()
+		record, err := NewRecordFromReplay(Replay{ReplaySteps: steps})
+		if err != nil {
+			t.Fatalf("NewRecordFromReplay() error = %v", err)
+		}
+		return record
+	}
+
+	first := build(turn(1), finished)
+	if first.ID == uuid.NewSHA1(uuid.NameSpaceDNS, []byte("|||")) {
+		t.Errorf("ID is derived from empty values only")
+	}
+	if again := build(turn(1), finished); again.ID != first.ID {
+		t.Errorf("ID = %s for the same steps, want %s", again.ID, first.ID)
+	}
+	if other := build(turn(2), finished); other.ID == first.ID {
+		t.Errorf("ID = %s for other steps, want a different one", other.ID)
+	}
+}
+
+func TestNewRecordFromReplayMatchesParse(t *testing.T) {
+	var replay Replay
+	if err := xml.Unmarshal(readFixture(t, "match.xml"), &replay); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := NewRecordFromReplay(replay)
+	if err != nil {
+		t.Fatalf("NewRecordFromReplay() error = %v", err)
+	}
+	parsed := parseFixture(t, "match.xml")
+
+	if record.MatchID != parsed.MatchID || record.Home.Score != parsed.Home.Score || len(record.Timeline) != len(parsed.Timeline) {
+		t.Errorf("NewRecordFromReplay() = %s %d events, Parse() = %s %d events",
+			record.MatchID, len(record.Timeline), parsed.MatchID, len(parsed.Timeline))
+	}
+	if record.ContentHash != "" {
+		t.Errorf("ContentHash = %s, want none without the raw replay", record.ContentHash)
+	}
+}
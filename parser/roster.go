@@ -0,0 +1,211 @@
+package parser
+
+// Characteristics a lasting injury can reduce
+const (
+	CharacteristicMovement = "MA"
+	CharacteristicAgility  = "AG"
+	CharacteristicArmor    = "AV"
+	CharacteristicStrength = "ST"
+)
+
+// casualtyEffect is what a casualty means for the player after the match,
+// they're part of the casualties mapping
+type casualtyEffect struct {
+	MissNextGame   bool   `yaml:"miss_next_game"`
+	Niggling       bool   `yaml:"niggling"`
+	Characteristic string `yaml:"characteristic"`
+	Dead           bool   `yaml:"dead"`
+}
+
+// RosterEntry is a player of the team as they are at one point in time
+type RosterEntry struct {
+	ID               int
+	Name             string
+	Type             GameID
+	Movement         int
+	Agility          int
+	Armor            int
+	Strength         int
+	Skills           []GameID
+	Injuries         []GameID
+	NigglingInjuries int
+	MissNextGame     bool
+	Dead             bool
+}
+
+// RosterChanges lists by player name what the match did to the team
+type RosterChanges struct {
+	Deaths           []string
+	MissNextGame     []string
+	NigglingInjuries []string
+	Reductions       []CharacteristicChange
+	LevelUps         []string
+	Returning        []string
+}
+
+type CharacteristicChange struct {
+	Player         string
+	Characteristic string
+	Change         int
+}
+
+func newRosterChanges() RosterChanges {
+	return RosterChanges{
+		Deaths:           make([]string, 0),
+		MissNextGame:     make([]string, 0),
+		NigglingInjuries: make([]string, 0),
+		Reductions:       make([]CharacteristicChange, 0),
+		LevelUps:         make([]string, 0),
+		Returning:        make([]string, 0),
+	}
+}
+
+// rosters puts together the roster at kickoff and after the match. Star players
+// and mercenaries aren't part of the roster so they're left out.
+//
+// The player results are what the players are like after the match, so the
+// roster at kickoff comes from the board state the players were first seen in
+// and the roster after the match is that with the casualties of the match applied.
+func (b *recordBuilder) rosters(team *TeamStats) {
+	team.RosterBefore = make([]RosterEntry, 0, len(team.PlayerResults))
+	team.RosterAfter = make([]RosterEntry, 0, len(team.PlayerResults))
+	team.RosterChanges = newRosterChanges()
+
+	for _, player := range team.PlayerResults {
+		if player.StarPlayer || player.Mercenary {
+			continue
+		}
+
+		before := b.rosterEntryBefore(player)
+		after := rosterEntryAfter(before, player)
+		team.RosterBefore = append(team.RosterBefore, before)
+		team.RosterAfter = append(team.RosterAfter, after)
+
+		changes := &team.RosterChanges
+		if after.Dead {
+			changes.Deaths = append(changes.Deaths, player.Name)
+			continue
+		}
+		if after.MissNextGame {
+			changes.MissNextGame = append(changes.MissNextGame, player.Name)
+		} else if before.MissNextGame {
+			changes.Returning = append(changes.Returning, player.Name)
+		}
+		if after.NigglingInjuries > before.NigglingInjuries {
+			changes.NigglingInjuries = append(changes.NigglingInjuries, player.Name)
+		}
+		for _, change := range characteristicChanges(before, after) {
+			change.Player = player.Name
+			changes.Reductions = append(changes.Reductions, change)
+		}
+		if player.Advancement.LevelUp {
+			changes.LevelUps = append(changes.LevelUps, player.Name)
+		}
+	}
+}
+
+// rosterEntryBefore is the player at kickoff. A player that never showed up on
+// the board missed the match, what's known about them is taken from the results.
+func (b *recordBuilder) rosterEntryBefore(player PlayerResult) RosterEntry {
+	entry := RosterEntry{
+		ID:       player.ID,
+		Name:     player.Name,
+		Type:     player.Type,
+		Movement: player.Movement,
+		Agility:  player.Agility,
+		Armor:    player.Armor,
+		Strength: player.Strength,
+		Skills:   append(make([]GameID, 0, len(player.Skills)), player.Skills...),
+		Injuries: make([]GameID, 0, len(player.LastingInjuries)),
+	}
+
+	if state, ok := b.initialPlayers[player.ID]; ok {
+		entry.Movement = state.Movement
+		entry.Agility = state.Agility
+		entry.Armor = state.Armor
+		entry.Strength = state.Strength
+		entry.Skills = parseIDList(SkillMapping, state.Skills)
+	} else if len(b.initialPlayers) > 0 {
+		entry.MissNextGame = true
+	}
+
+	// The lasting injuries already include the ones from this match
+	sustained := make(map[int]int)
+	for _, casualty := range player.Casualties {
+		sustained[casualty.ID]++
+	}
+	for _, injury := range player.LastingInjuries {
+		if sustained[injury.ID] > 0 {
+			sustained[injury.ID]--
+			continue
+		}
+		entry.Injuries = append(entry.Injuries, injury)
+		if effect, _ := CasualtyMapping.effect(injury.ID); effect.Niggling {
+			entry.NigglingInjuries++
+		}
+	}
+
+	return entry
+}
+
+func rosterEntryAfter(before RosterEntry, player PlayerResult) RosterEntry {
+	after := before
+	after.Skills = append(make([]GameID, 0, len(player.Skills)), player.Skills...)
+	after.Injuries = append(make([]GameID, 0, len(before.Injuries)+len(player.Casualties)), before.Injuries...)
+	after.MissNextGame = false
+
+	for _, casualty := range player.Casualties {
+		effect, ok := CasualtyMapping.effect(casualty.ID)
+		if !ok {
+			continue
+		}
+
+		if effect.Dead {
+			after.Dead = true
+		}
+		if effect.MissNextGame {
+			after.MissNextGame = true
+		}
+		if effect.Niggling {
+			after.NigglingInjuries++
+		}
+		if effect.Niggling || effect.Characteristic != "" {
+			after.Injuries = append(after.Injuries, casualty)
+		}
+
+		switch effect.Characteristic {
+		case CharacteristicMovement:
+			after.Movement--
+		case CharacteristicAgility:
+			after.Agility--
+		case CharacteristicArmor:
+			after.Armor--
+		case CharacteristicStrength:
+			after.Strength--
+		}
+	}
+
+	return after
+}
+
+func characteristicChanges(before, after RosterEntry) []CharacteristicChange {
+	changes := make([]CharacteristicChange, 0)
+	values := []struct {
+		characteristic string
+		before, after  int
+	}{
+		{CharacteristicMovement, before.Movement, after.Movement},
+		{CharacteristicAgility, before.Agility, after.Agility},
+		{CharacteristicArmor, before.Armor, after.Armor},
+		{CharacteristicStrength, before.Strength, after.Strength},
+	}
+	for _, v := range values {
+		if v.after != v.before {
+			changes = append(changes, CharacteristicChange{
+				Characteristic: v.characteristic,
+				Change:         v.after - v.before,
+			})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCasualtyEffects(t *testing.T) {
+	tests := []struct {
+		id   int
+		want casualtyEffect
+		ok   bool
+	}{
+		{1, casualtyEffect{}, false},
+		{2, casualtyEffect{MissNextGame: true}, true},
+		{10, casualtyEffect{MissNextGame: true, Niggling: true}, true},
+		{12, casualtyEffect{MissNextGame: true, Characteristic: CharacteristicMovement}, true},
+		{15, casualtyEffect{MissNextGame: true, Characteristic: CharacteristicArmor}, true},
+		{16, casualtyEffect{MissNextGame: true, Characteristic: CharacteristicAgility}, true},
+		{17, casualtyEffect{MissNextGame: true, Characteristic: CharacteristicStrength}, true},
+		{18, casualtyEffect{Dead: true}, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := CasualtyMapping.effect(tt.id)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("effect(%d) = %+v, %v, want %+v, %v", tt.id, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func ids(list []GameID) []int {
+	result := make([]int, 0, len(list))
+	for _, id := range list {
+		result = append(result, id.ID)
+	}
+	return result
+}
+
+func TestRostersFromReplay(t *testing.T) {
+	record := parseFixture(t, "match.xml")
+
+	// Grom came into the match with a niggling injury and had his armor reduced
+	before, after := record.Away.RosterBefore[0], record.Away.RosterAfter[0]
+	if before.Armor != 9 || !reflect.DeepEqual(ids(before.Injuries), []int{10}) || before.NigglingInjuries != 1 || before.MissNextGame {
+		t.Errorf("Grom before = %+v, want AV 9 and the niggling injury", before)
+	}
+	if after.Armor != 8 || !reflect.DeepEqual(ids(after.Injuries), []int{10, 14}) || after.NigglingInjuries != 1 || !after.MissNextGame {
+		t.Errorf("Grom after = %+v, want AV 8 and missing the next game", after)
+	}
+
+	// Griff learned Sprint
+	griffBefore, griffAfter := record.Home.RosterBefore[0], record.Home.RosterAfter[0]
+	if !reflect.DeepEqual(ids(griffBefore.Skills), []int{7}) || !reflect.DeepEqual(ids(griffAfter.Skills), []int{7, 8}) {
+		t.Errorf("Griff skills = %v to %v, want [7] to [7 8]", ids(griffBefore.Skills), ids(griffAfter.Skills))
+	}
+
+	wantAway := RosterChanges{
+		Deaths:           []string{},
+		MissNextGame:     []string{"Grom"},
+		NigglingInjuries: []string{},
+		Reductions:       []CharacteristicChange{{Player: "Grom", Characteristic: CharacteristicArmor, Change: -1}},
+		LevelUps:         []string{},
+		Returning:        []string{},
+	}
+	if !reflect.DeepEqual(record.Away.RosterChanges, wantAway) {
+		t.Errorf("Away RosterChanges = %+v, want %+v", record.Away.RosterChanges, wantAway)
+	}
+	if !reflect.DeepEqual(record.Home.RosterChanges.LevelUps, []string{"Griff"}) {
+		t.Errorf("Home LevelUps = %v, want Griff", record.Home.RosterChanges.LevelUps)
+	}
+}
+
+func TestRosterEntries(t *testing.T) {
+	casualty := func(id int) GameID { return NewGameID(CasualtyMapping, id) }
+	board := map[int]PlayerState{
+		1: {ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: "(7)"},
+	}
+
+	tests := []struct {
+		name   string
+		board  map[int]PlayerState
+		player PlayerResult
+		before RosterEntry
+		after  RosterEntry
+	}{
+		{
+			name:   "nothing happened",
+			board:  board,
+			player: PlayerResult{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{{ID: 7}}},
+			before: RosterEntry{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{{ID: 7}}, Injuries: []GameID{}},
+			after:  RosterEntry{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{{ID: 7}}, Injuries: []GameID{}},
+		},
+		{
+			name:  "niggling injury",
+			board: board,
+			player: PlayerResult{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3,
+				Casualties: []GameID{casualty(10)}, LastingInjuries: []GameID{casualty(10)}},
+			before: RosterEntry{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{{ID: 7}}, Injuries: []GameID{}},
+			after: RosterEntry{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{}, Injuries: []GameID{casualty(10)},
+				NigglingInjuries: 1, MissNextGame: true},
+		},
+		{
+			name:   "death",
+			board:  board,
+			player: PlayerResult{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Casualties: []GameID{casualty(18)}},
+			before: RosterEntry{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{{ID: 7}}, Injuries: []GameID{}},
+			after:  RosterEntry{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{}, Injuries: []GameID{}, Dead: true},
+		},
+		{
+			name:   "sat the match out",
+			board:  board,
+			player: PlayerResult{ID: 2, Movement: 5, Agility: 3, Armor: 9, Strength: 3},
+			before: RosterEntry{ID: 2, Movement: 5, Agility: 3, Armor: 9, Strength: 3, Skills: []GameID{}, Injuries: []GameID{}, MissNextGame: true},
+			after:  RosterEntry{ID: 2, Movement: 5, Agility: 3, Armor: 9, Strength: 3, Skills: []GameID{}, Injuries: []GameID{}},
+		},
+		{
+			name:   "no board state",
+			board:  map[int]PlayerState{},
+			player: PlayerResult{ID: 2, Movement: 5, Agility: 3, Armor: 9, Strength: 3},
+			before: RosterEntry{ID: 2, Movement: 5, Agility: 3, Armor: 9, Strength: 3, Skills: []GameID{}, Injuries: []GameID{}},
+			after:  RosterEntry{ID: 2, Movement: 5, Agility: 3, Armor: 9, Strength: 3, Skills: []GameID{}, Injuries: []GameID{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newRecordBuilder()
+			b.initialPlayers = tt.board
+
+			before := b.rosterEntryBefore(tt.player)
+			for i := range before.Skills {
+				before.Skills[i].Name = nil
+			}
+			if !reflect.DeepEqual(before, tt.before) {
+				t.Errorf("rosterEntryBefore() = %+v, want %+v", before, tt.before)
+			}
+			if after := rosterEntryAfter(before, tt.player); !reflect.DeepEqual(after, tt.after) {
+				t.Errorf("rosterEntryAfter() = %+v, want %+v", after, tt.after)
+			}
+		})
+	}
+}
+
+func TestRosterAfterCasualtyOverride(t *testing.T) {
+	dir := t.TempDir()
+	// A new casualty without an effects section like most overrides
+	writeMapping(t, dir, "casualties", "version: 2\nids:\n  11: Smashed Knee\n  12: Smashed Hip\n  18: Death\n  19: Eaten\n", time.Now())
+	if err := CasualtyMapping.reload(dir); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	t.Cleanup(func() {
+		os.Remove(filepath.Join(dir, "casualties.yml")) // nolint
+		if err := CasualtyMapping.reload(dir); err != nil {
+			t.Errorf("Failed to restore the embedded casualties: %v", err)
+		}
+	})
+
+	casualty := func(id int) GameID { return NewGameID(CasualtyMapping, id) }
+	before := RosterEntry{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{}, Injuries: []GameID{}}
+
+	tests := []struct {
+		name   string
+		player PlayerResult
+		after  RosterEntry
+	}{
+		{
+			name: "characteristic reduction",
+			player: PlayerResult{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3,
+				Casualties: []GameID{casualty(12)}, LastingInjuries: []GameID{casualty(12)}},
+			after: RosterEntry{ID: 1, Movement: 5, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{}, Injuries: []GameID{casualty(12)},
+				MissNextGame: true},
+		},
+		{
+			name:   "death",
+			player: PlayerResult{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Casualties: []GameID{casualty(18)}},
+			after:  RosterEntry{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{}, Injuries: []GameID{}, Dead: true},
+		},
+		{
+			name:   "new casualty",
+			player: PlayerResult{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Casualties: []GameID{casualty(19)}},
+			after:  RosterEntry{ID: 1, Movement: 6, Agility: 3, Armor: 8, Strength: 3, Skills: []GameID{}, Injuries: []GameID{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if after := rosterEntryAfter(before, tt.player); !reflect.DeepEqual(after, tt.after) {
+				t.Errorf("rosterEntryAfter() = %+v, want %+v", after, tt.after)
+			}
+		})
+	}
+	if got := CasualtyMapping.Name(19); got != "Eaten" {
+		t.Errorf("Name(19) = %s, want the override", got)
+	}
+}
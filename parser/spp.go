@@ -0,0 +1,111 @@
+package parser
+
+// Star player points awarded for each source
+const (
+	sppTouchdown    = 3
+	sppCompletion   = 1
+	sppInterception = 2
+	sppCasualty     = 2
+	sppMVP          = 5
+)
+
+// levelThresholds are the star player points needed to reach each level,
+// level 1 is a rookie and needs none
+var levelThresholds = []int{0, 6, 16, 31, 51, 76, 176}
+
+// SPP breaks down the star player points a player earned in the match by source
+type SPP struct {
+	Touchdowns    int
+	Completions   int
+	Interceptions int
+	Casualties    int
+	MVP           int
+	Total         int
+}
+
+func newSPP(touchdowns, completions, interceptions, casualties int, mvp bool) SPP {
+	spp := SPP{
+		Touchdowns:    touchdowns * sppTouchdown,
+		Completions:   completions * sppCompletion,
+		Interceptions: interceptions * sppInterception,
+		Casualties:    casualties * sppCasualty,
+	}
+	if mvp {
+		spp.MVP = sppMVP
+	}
+	spp.Total = spp.Touchdowns + spp.Completions + spp.Interceptions + spp.Casualties + spp.MVP
+	return spp
+}
+
+// Advancement tracks how the player developed over the match
+type Advancement struct {
+	ExperienceBefore int
+	ExperienceAfter  int
+	LevelBefore      int
+	LevelAfter       int
+	LevelUp          bool
+	SkillsGained     []GameID
+}
+
+func newAdvancement(experience, level, gained int) Advancement {
+	adv := Advancement{
+		ExperienceBefore: experience,
+		ExperienceAfter:  experience + gained,
+		LevelBefore:      level,
+		SkillsGained:     make([]GameID, 0),
+	}
+	if adv.LevelBefore == 0 {
+		adv.LevelBefore = levelFor(adv.ExperienceBefore)
+	}
+
+	adv.LevelAfter = levelFor(adv.ExperienceAfter)
+	if adv.LevelAfter < adv.LevelBefore {
+		adv.LevelAfter = adv.LevelBefore
+	}
+	adv.LevelUp = adv.LevelAfter > adv.LevelBefore
+
+	return adv
+}
+
+func levelFor(experience int) int {
+	level := 0
+	for _, threshold := range levelThresholds {
+		if experience >= threshold {
+			level++
+		}
+	}
+	return level
+}
+
+// trackPlayers remembers every player as they were the first time they show up on the board
+func (b *recordBuilder) trackPlayers(board BoardState) {
+	for _, team := range board.Teams {
+		for _, player := range team.Players {
+			if _, ok := b.initialPlayers[player.ID]; !ok {
+				b.initialPlayers[player.ID] = player
+			}
+		}
+	}
+}
+
+// skillsGained compares the skills the players ended the match with to the
+// ones they started it with
+func (b *recordBuilder) skillsGained(team *TeamStats) {
+	for i, player := range team.PlayerResults {
+		initial, ok := b.initialPlayers[player.ID]
+		if !ok {
+			continue
+		}
+
+		known := make(map[int]bool)
+		for _, skill := range parseDice(initial.Skills) {
+			known[skill] = true
+		}
+
+		for _, skill := range player.Skills {
+			if !known[skill.ID] {
+				team.PlayerResults[i].Advancement.SkillsGained = append(team.PlayerResults[i].Advancement.SkillsGained, skill)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewSPP(t *testing.T) {
+	tests := []struct {
+		name                                               string
+		touchdowns, completions, interceptions, casualties int
+		mvp                                                bool
+		want                                               SPP
+	}{
+		{name: "nothing", want: SPP{}},
+		{name: "touchdown and MVP", touchdowns: 1, mvp: true, want: SPP{Touchdowns: 3, MVP: 5, Total: 8}},
+		{
+			name:       "everything",
+			touchdowns: 2, completions: 3, interceptions: 1, casualties: 2,
+			want: SPP{Touchdowns: 6, Completions: 3, Interceptions: 2, Casualties: 4, Total: 15},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newSPP(tt.touchdowns, tt.completions, tt.interceptions, tt.casualties, tt.mvp)
+			if got != tt.want {
+				t.Errorf("newSPP() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAdvancement(t *testing.T) {
+	tests := []struct {
+		name                    string
+		experience, level, spp  int
+		levelBefore, levelAfter int
+		levelUp                 bool
+	}{
+		{name: "rookie without SPP", levelBefore: 1, levelAfter: 1},
+		{name: "rookie reaches level 2", experience: 4, spp: 2, levelBefore: 1, levelAfter: 2, levelUp: true},
+		{name: "short of the next level", experience: 6, spp: 9, levelBefore: 2, levelAfter: 2},
+		{name: "skips a level", experience: 14, spp: 20, levelBefore: 2, levelAfter: 4, levelUp: true},
+		{name: "stored level wins over experience", experience: 6, level: 3, spp: 1, levelBefore: 3, levelAfter: 3},
+		{name: "legend", experience: 170, spp: 10, levelBefore: 6, levelAfter: 7, levelUp: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newAdvancement(tt.experience, tt.level, tt.spp)
+			if got.ExperienceAfter != tt.experience+tt.spp {
+				t.Errorf("ExperienceAfter = %d, want %d", got.ExperienceAfter, tt.experience+tt.spp)
+			}
+			if got.LevelBefore != tt.levelBefore || got.LevelAfter != tt.levelAfter || got.LevelUp != tt.levelUp {
+				t.Errorf("newAdvancement() = level %d to %d, level up %v, want %d to %d, %v",
+					got.LevelBefore, got.LevelAfter, got.LevelUp, tt.levelBefore, tt.levelAfter, tt.levelUp)
+			}
+		})
+	}
+}
+
+func TestAdvancementFromReplay(t *testing.T) {
+	record := parseFixture(t, "match.xml")
+
+	griff := record.Home.PlayerResults[0]
+	if griff.SPP != (SPP{Touchdowns: 3, MVP: 5, Total: 8}) {
+		t.Errorf("Griff SPP = %+v", griff.SPP)
+	}
+	if !griff.Advancement.LevelUp || griff.Advancement.ExperienceAfter != 12 {
+		t.Errorf("Griff Advancement = %+v, want a level up with 12 SPP", griff.Advancement)
+	}
+	sprint := "Sprint"
+	if want := []GameID{{ID: 8, Name: &sprint}}; !reflect.DeepEqual(griff.Advancement.SkillsGained, want) {
+		t.Errorf("Griff SkillsGained = %+v, want Sprint", griff.Advancement.SkillsGained)
+	}
+	if record.Home.MVP != "Griff" {
+		t.Errorf("MVP = %s, want Griff", record.Home.MVP)
+	}
+
+	// Star players only play the one match
+	morg := record.Home.PlayerResults[1]
+	if morg.SPP.Casualties != 2 || morg.Advancement.LevelAfter != 0 {
+		t.Errorf("Morg SPP = %+v, Advancement = %+v, want SPP but no advancement", morg.SPP, morg.Advancement)
+	}
+}
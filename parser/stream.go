@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// StepFunc is called for every ReplayStep in the order they appear in the replay.
+// Returning an error stops the stream and Stream returns the same error.
+type StepFunc func(idx int, step ReplayStep) error
+
+// Header holds the values of the replay that are outside of the steps
+type Header struct {
+	ClientVersion string
+}
+
+// Stream reads the replay token by token and decodes one ReplayStep at a time,
+// so memory use stays roughly the same no matter how long the replay is.
+func Stream(r io.Reader, fn StepFunc) (Header, error) {
+	decoder := xml.NewDecoder(r)
+
+	var header Header
+	idx := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return header, nil
+		}
+		if err != nil {
+			return header, streamError(err, decoder, idx)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if start.Name.Local == "ClientVersion" {
+			if err := decoder.DecodeElement(&header.ClientVersion, &start); err != nil {
+				return header, streamError(err, decoder, -1)
+			}
+			continue
+		}
+
+		if start.Name.Local != "ReplayStep" {
+			continue
+		}
+
+		var step ReplayStep
+		if err := decoder.DecodeElement(&step, &start); err != nil {
+			return header, streamError(err, decoder, idx)
+		}
+
+		if err := fn(idx, step); err != nil {
+			return header, err
+		}
+		idx++
+	}
+}
+
+// streamError tells apart broken XML from the underlying reader failing, which
+// happens when the archive the XML is read from is corrupt or cut short
+func streamError(err error, decoder *xml.Decoder, step int) error {
+	var syntaxErr *xml.SyntaxError
+	var unmarshalErr xml.UnmarshalError
+	var numErr *strconv.NumError
+
+	kind := KindInvalidArchive
+	line := -1
+	switch {
+	case errors.As(err, &syntaxErr):
+		kind = KindXMLSyntax
+		line = syntaxErr.Line
+	case errors.As(err, &unmarshalErr), errors.As(err, &numErr):
+		kind = KindXMLSyntax
+	}
+
+	perr := newError(kind, err)
+	perr.Step = step
+	perr.Line = line
+	perr.Offset = decoder.InputOffset()
+	return perr
+}
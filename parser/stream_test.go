@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	data := readFixture(t, "match.xml")
+
+	indexes := make([]int, 0)
+	header, err := Stream(bytes.NewReader(data), func(idx int, step ReplayStep) error {
+		indexes = append(indexes, idx)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+
+	if header.ClientVersion != "1.0.0.1" {
+		t.Errorf("ClientVersion = %s, want 1.0.0.1", header.ClientVersion)
+	}
+	if len(indexes) != 6 {
+		t.Fatalf("Stream() called fn %d times, want 6", len(indexes))
+	}
+	for i, idx := range indexes {
+		if idx != i {
+			t.Errorf("step %d has index %d", i, idx)
+		}
+	}
+}
+
+func TestStreamStopsOnError(t *testing.T) {
+	data := readFixture(t, "match.xml")
+	stop := errors.New("stop")
+
+	calls := 0
+	_, err := Stream(bytes.NewReader(data), func(idx int, step ReplayStep) error {
+		calls++
+		if idx == 1 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("Stream() error = %v, want %v", err, stop)
+	}
+	if calls != 2 {
+		t.Errorf("Stream() called fn %d times, want 2", calls)
+	}
+}
+
+// failingReader returns the data and then fails like a corrupt archive would
+type failingReader struct {
+	r io.Reader
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("flate: corrupt input")
+	}
+	return n, err
+}
+
+func TestStreamErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		r    io.Reader
+		kind ErrorKind
+		step int
+	}{
+		{
+			name: "broken XML",
+			r:    strings.NewReader("<Replay><ReplayStep></ReplayStep><ReplayStep><BoardState></ReplayStep></Replay>"),
+			kind: KindXMLSyntax,
+			step: 1,
+		},
+		{
+			name: "invalid number",
+			r:    strings.NewReader("<Replay><ReplayStep><RulesEventEndTurn><Reason>x</Reason></RulesEventEndTurn></ReplayStep></Replay>"),
+			kind: KindXMLSyntax,
+			step: 0,
+		},
+		{
+			name: "reader fails",
+			r:    failingReader{strings.NewReader("<Replay><ReplayStep></ReplayStep><ReplayStep>")},
+			kind: KindInvalidArchive,
+			step: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Stream(tt.r, func(idx int, step ReplayStep) error { return nil })
+
+			var perr *Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("Stream() error = %v, want a parser error", err)
+			}
+			if perr.Kind != tt.kind {
+				t.Errorf("Kind = %s, want %s", perr.Kind, tt.kind)
+			}
+			if perr.Step != tt.step {
+				t.Errorf("Step = %d, want %d", perr.Step, tt.step)
+			}
+			if perr.Offset < 0 {
+				t.Errorf("Offset = %d, want the position in the input", perr.Offset)
+			}
+		})
+	}
+}
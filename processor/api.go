@@ -0,0 +1,135 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/helper"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// TaskResponse is how a task is shown to clients. ReplayID is only set once
+// the replay is stored and NextAttempt only while a failed task waits for a retry.
+type TaskResponse struct {
+	ID          uuid.UUID
+	Name        string
+	BatchID     *uuid.UUID
+	Status      string
+	Error       string
+	ErrorKind   parser.ErrorKind
+	ErrorClass  ErrorClass
+	Attempts    int
+	NextAttempt *time.Time
+	ReplayID    *uuid.UUID
+}
+
+// TaskLocation is the URL a task's status can be polled at
+func TaskLocation(id uuid.UUID) string {
+	return fmt.Sprintf("/api/tasks/%s", id.String())
+}
+
+func newTaskResponse(task Task) TaskResponse {
+	return newTaskResponseFromStored(task.persisted())
+}
+
+func newTaskResponseFromStored(task database.Task) TaskResponse {
+	res := TaskResponse{
+		ID:         task.ID,
+		Name:       task.Name,
+		Status:     task.Status,
+		Error:      task.Error,
+		ErrorKind:  parser.ErrorKind(task.ErrorKind),
+		ErrorClass: ErrorClass(task.Class),
+		Attempts:   task.Attempts,
+	}
+	if !task.NextAttempt.IsZero() {
+		res.NextAttempt = &task.NextAttempt
+	}
+	if task.ReplayID != uuid.Nil {
+		res.ReplayID = &task.ReplayID
+	}
+	if task.BatchID != uuid.Nil {
+		res.BatchID = &task.BatchID
+	}
+	return res
+}
+
+// Task looks the task up in memory first since that's where the latest state
+// of queued tasks is, finished ones come from the database
+func (r *Registry) Task(id uuid.UUID) (TaskResponse, error) {
+	if task, ok := r.tasks.Snapshot(id); ok {
+		return newTaskResponse(task), nil
+	}
+
+	stored, err := r.db.GetTask(id)
+	if err != nil {
+		return TaskResponse{}, err
+	}
+	return newTaskResponseFromStored(stored), nil
+}
+
+// Tasks lists every task in one of the given statuses, or all of them if there are none
+func (r *Registry) Tasks(statuses ...string) ([]TaskResponse, error) {
+	stored, err := r.db.GetTasks(statuses...)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]TaskResponse, 0, len(stored))
+	for _, task := range stored {
+		tasks = append(tasks, newTaskResponseFromStored(task))
+	}
+	return tasks, nil
+}
+
+func (r *Registry) HandleTask(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		logger.WithError(err).WithField("id", vars["id"]).Error("Failed to parse task ID")
+		helper.E(w, http.StatusBadRequest)
+		return
+	}
+
+	task, err := r.Task(id)
+	if errors.Is(err, database.ErrNotFound) {
+		helper.E(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithError(err).WithField("id", id).Error("Failed to get task")
+		helper.E(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, task)
+}
+
+// HandleTaskList serves GET /api/tasks, the list can be narrowed down with ?status=failed&status=dead
+func (r *Registry) HandleTaskList(w http.ResponseWriter, req *http.Request) {
+	tasks, err := r.Tasks(req.URL.Query()["status"]...)
+	if err != nil {
+		logger.WithError(err).Error("Failed to get tasks")
+		helper.E(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(v); err != nil {
+		logger.WithError(err).Error("Failed to encode response")
+	}
+}
@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestHandleTask(t *testing.T) {
+	db := newTaskDB()
+	r := newTestRegistry(t, db, newMemBlobs())
+
+	// Queued already so the workers leave it alone
+	waiting := Task{ID: uuid.New(), Name: "waiting.bbrz", Status: Waiting, queued: true}
+	r.tasks.Add(waiting)
+
+	failed := Task{
+		ID:         uuid.New(),
+		Name:       "failed.bbrz",
+		Status:     Failed,
+		Error:      parser.ErrNoSteps,
+		ErrorKind:  parser.KindNoSteps,
+		ErrorClass: ClassParse,
+		Attempts:   1,
+	}
+	db.UpdateTask(failed.persisted()) // nolint
+
+	stored := database.Task{ID: uuid.New(), Name: "stored.bbrz", Status: OK.String(), ReplayID: uuid.New()}
+	db.UpdateTask(stored) // nolint
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/tasks/{id}", r.HandleTask)
+
+	tests := []struct {
+		name   string
+		id     string
+		code   int
+		status string
+		want   TaskResponse
+	}{
+		{"waiting", waiting.ID.String(), http.StatusOK, Waiting.String(), newTaskResponse(waiting)},
+		{"failed", failed.ID.String(), http.StatusOK, Failed.String(), newTaskResponse(failed)},
+		{"from before a restart", stored.ID.String(), http.StatusOK, OK.String(), newTaskResponseFromStored(stored)},
+		{"unknown", uuid.NewString(), http.StatusNotFound, "", TaskResponse{}},
+		{"invalid ID", "nope", http.StatusBadRequest, "", TaskResponse{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tasks/"+tt.id, nil))
+
+			if w.Code != tt.code {
+				t.Fatalf("GET task = %d, want %d", w.Code, tt.code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var res TaskResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if res.ID != tt.want.ID || res.Name != tt.want.Name || res.Status != tt.status || res.Error != tt.want.Error || res.ErrorKind != tt.want.ErrorKind {
+				t.Errorf("GET task = %+v, want %+v", res, tt.want)
+			}
+			if (res.ReplayID == nil) != (tt.want.ReplayID == nil) {
+				t.Errorf("ReplayID = %v, want %v", res.ReplayID, tt.want.ReplayID)
+			}
+		})
+	}
+}
+
+func TestTaskWhileProcessing(t *testing.T) {
+	setRetryPolicy(t, ClassDatabase, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	db := newTaskDB()
+	db.saveErrs = []error{errConnRefused, errConnRefused}
+	r := newTestRegistry(t, db, newMemBlobs())
+
+	id, err := r.ProcessFile(spool(t, "upload.bbrz", readFixture(t, "match.xml")))
+	if err != nil {
+		t.Fatalf("ProcessFile() error = %v", err)
+	}
+
+	// Readers get a copy while the task is rescheduled and finished
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for db.status(id) != OK.String() {
+				if _, err := r.Task(id); err != nil && !errors.Is(err, database.ErrNotFound) {
+					t.Errorf("Task() error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	waitFor(t, "task to finish", func() bool { return db.status(id) == OK.String() })
+	wg.Wait()
+
+	task, err := r.Task(id)
+	if err != nil {
+		t.Fatalf("Task() error = %v", err)
+	}
+	if task.Attempts != 2 || task.ReplayID == nil {
+		t.Errorf("Task() = %+v, want 2 failed attempts and a replay", task)
+	}
+}
@@ -0,0 +1,426 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/helper"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxBatchEntrySize and maxBatchSize cap how much is extracted from a single
+// entry and from all entries of a bulk upload so a zip bomb can't fill up the spool
+const (
+	maxBatchEntrySize = 64 << 20
+	maxBatchSize      = 1 << 30
+)
+
+var ErrBatchOversized = fmt.Errorf("Batch is larger than %d bytes uncompressed", maxBatchSize)
+
+// batchEntry is a replay extracted from a bulk upload into the spool
+type batchEntry struct {
+	Name     string
+	Filename string
+}
+
+// BatchResponse shows how far a bulk upload got. Status is "pending" while any
+// of its tasks still wait or are being processed and "finished" after that.
+// Known lists the entries that were left out because they're already known,
+// it's only part of the answer to the upload itself.
+type BatchResponse struct {
+	ID     uuid.UUID
+	Status string
+	Counts map[string]int
+	Tasks  []TaskResponse
+	Known  []KnownResponse
+}
+
+const (
+	BatchPending  = "pending"
+	BatchFinished = "finished"
+)
+
+// BatchLocation is the URL a batch's status can be polled at
+func BatchLocation(id uuid.UUID) string {
+	return fmt.Sprintf("/api/batches/%s", id.String())
+}
+
+// extractBatch checks whether the uploaded file is an archive of replays and
+// extracts them into the spool. A single replay returns no entries and no error,
+// a .bbrz is a zip itself so only archives with .bbrz entries count as bulk uploads.
+func extractBatch(filename string) ([]batchEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open upload: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to stat upload: %w", err)
+	}
+
+	header := make([]byte, 512)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Failed to read upload header: %w", err)
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return extractZipBatch(f, info.Size())
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		open := func() (io.ReadCloser, error) {
+			return gzip.NewReader(io.NewSectionReader(f, 0, info.Size()))
+		}
+		gr, err := open()
+		if err != nil {
+			return nil, nil
+		}
+
+		// Peek into the stream, a gzip can just as well be a single compressed replay
+		var inner bytes.Buffer
+		_, err = io.CopyN(&inner, gr, 512)
+		gr.Close()
+		if err != nil && err != io.EOF {
+			return nil, nil
+		}
+		if !isTar(inner.Bytes()) {
+			return nil, nil
+		}
+		return extractTarBatch(open)
+	case isTar(header):
+		return extractTarBatch(func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(f, 0, info.Size())), nil
+		})
+	}
+
+	return nil, nil
+}
+
+func isTar(header []byte) bool {
+	return len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar"))
+}
+
+func isReplayEntry(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".bbrz")
+}
+
+func extractZipBatch(r io.ReaderAt, size int64) ([]batchEntry, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		// Leave broken zips to the parser, it can salvage truncated replays
+		return nil, nil
+	}
+
+	// The central directory lists every entry with its size up front
+	replays := make([]*zip.File, 0)
+	var total uint64
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() && isReplayEntry(f.Name) {
+			replays = append(replays, f)
+			total += f.UncompressedSize64
+		}
+	}
+	if len(replays) == 0 {
+		return nil, nil
+	}
+	// Turned away before anything is extracted, the sizes in the directory can
+	// be forged though so the budget is still checked while extracting
+	if total > maxBatchSize {
+		return nil, ErrBatchOversized
+	}
+
+	entries := make([]batchEntry, 0, len(replays))
+	budget := int64(maxBatchSize)
+	for _, f := range replays {
+		rc, err := f.Open()
+		if err != nil {
+			removeEntries(entries)
+			return nil, fmt.Errorf("Failed to open %s in zip file: %w", f.Name, err)
+		}
+		entry, n, err := spoolEntry(f.Name, rc, budget)
+		rc.Close()
+		if err != nil {
+			removeEntries(entries)
+			return nil, err
+		}
+		budget -= n
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// countTarReplays reads through the archive once to find out how many replays
+// it holds and how large they are, it stops as soon as the batch is oversized
+func countTarReplays(r io.Reader) (int, int64, error) {
+	tr := tar.NewReader(r)
+	count := 0
+	var size int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return count, size, nil
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("Failed to read tar archive: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg || !isReplayEntry(hdr.Name) {
+			continue
+		}
+		count++
+		size += hdr.Size
+		if size > maxBatchSize {
+			return count, size, nil
+		}
+	}
+}
+
+// extractTarBatch reads the archive twice, open returns it from the start
+func extractTarBatch(open func() (io.ReadCloser, error)) ([]batchEntry, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read tar archive: %w", err)
+	}
+	count, size, err := countTarReplays(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	if size > maxBatchSize {
+		return nil, ErrBatchOversized
+	}
+
+	rc, err = open()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read tar archive: %w", err)
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	entries := make([]batchEntry, 0, count)
+	budget := int64(maxBatchSize)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			removeEntries(entries)
+			return nil, fmt.Errorf("Failed to read tar archive: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg || !isReplayEntry(hdr.Name) {
+			continue
+		}
+
+		entry, n, err := spoolEntry(hdr.Name, tr, budget)
+		if err != nil {
+			removeEntries(entries)
+			return nil, err
+		}
+		budget -= n
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// spoolEntry extracts an entry into the spool and returns how many bytes it
+// took, budget is what's left of maxBatchSize for the rest of the batch
+func spoolEntry(name string, r io.Reader, budget int64) (batchEntry, int64, error) {
+	limit := int64(maxBatchEntrySize)
+	if budget < limit {
+		limit = budget
+	}
+
+	filename := filepath.Join(SpoolPath(), fmt.Sprintf("%s.bbrz", uuid.New().String()))
+	f, err := os.Create(filename)
+	if err != nil {
+		return batchEntry{}, 0, fmt.Errorf("Failed to create destination file: %w", err)
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, io.LimitReader(r, limit+1))
+	if err == nil && n > limit {
+		err = fmt.Errorf("Entry is larger than %d bytes", limit)
+		if limit < maxBatchEntrySize {
+			err = ErrBatchOversized
+		}
+	}
+	if err != nil {
+		os.Remove(filename) // nolint
+		return batchEntry{}, 0, fmt.Errorf("Failed to extract %s: %w", name, err)
+	}
+
+	return batchEntry{Name: name, Filename: filename}, n, nil
+}
+
+func removeEntries(entries []batchEntry) {
+	for _, entry := range entries {
+		os.Remove(entry.Filename) // nolint
+	}
+}
+
+// processBatch persists every entry of a bulk upload as its own waiting task,
+// the workers get to them as the queue drains. The batch counts as a single
+// upload against the queue. Entries that are already known are left out, if
+// that's all of them no batch is created.
+func (r *Registry) processBatch(entries []batchEntry) (uuid.UUID, []KnownResponse, error) {
+	known := make([]KnownResponse, 0)
+	if err := r.Accepting(); err != nil {
+		return uuid.Nil, known, err
+	}
+
+	batchID := uuid.New()
+	queued := 0
+	for i, entry := range entries {
+		_, err := r.enqueue(entry.Filename, entry.Name, batchID)
+		var knownErr *KnownError
+		if errors.As(err, &knownErr) {
+			os.Remove(entry.Filename) // nolint
+			known = append(known, newKnownResponse(entry.Name, knownErr))
+			continue
+		}
+		if err != nil {
+			removeEntries(entries[i:])
+			if queued == 0 {
+				return uuid.Nil, known, err
+			}
+			return batchID, known, err
+		}
+		queued++
+	}
+
+	if queued == 0 {
+		return uuid.Nil, known, nil
+	}
+
+	logger.WithFields(log.Fields{
+		"batch_id": batchID.String(),
+		"tasks":    queued,
+		"known":    len(known),
+	}).Info("Queued bulk upload")
+	return batchID, known, nil
+}
+
+func (r *Registry) handleBatch(w http.ResponseWriter, entries []batchEntry) {
+	batchID, known, err := r.processBatch(entries)
+	if err != nil && batchID == uuid.Nil {
+		removeEntries(entries)
+		switch {
+		case errors.Is(err, ErrQueueFull), errors.Is(err, ErrStopped):
+			rejectRequest(w, err)
+		default:
+			logger.WithError(err).Error("Failed to queue bulk upload")
+			helper.E(w, http.StatusInternalServerError)
+		}
+		return
+	}
+	if err != nil {
+		// Some tasks made it into the queue already, they're reported with the rest of the batch
+		logger.WithError(err).WithField("batch_id", batchID.String()).Error("Failed to queue every entry of bulk upload")
+	}
+
+	// Every replay in the archive has been uploaded before
+	if batchID == uuid.Nil {
+		writeJSON(w, http.StatusOK, BatchResponse{
+			Status: Known,
+			Counts: map[string]int{Known: len(known)},
+			Tasks:  make([]TaskResponse, 0),
+			Known:  known,
+		})
+		return
+	}
+
+	batch, err := r.Batch(batchID)
+	if err != nil {
+		logger.WithError(err).WithField("batch_id", batchID.String()).Error("Failed to get queued batch")
+		helper.E(w, http.StatusInternalServerError)
+		return
+	}
+	if len(known) > 0 {
+		batch.Counts[Known] = len(known)
+		batch.Known = known
+	}
+
+	w.Header().Set("Location", BatchLocation(batchID))
+	writeJSON(w, http.StatusAccepted, batch)
+}
+
+// Batch collects the current state of every task of a bulk upload
+func (r *Registry) Batch(id uuid.UUID) (BatchResponse, error) {
+	stored, err := r.db.GetBatch(id)
+	if err != nil {
+		return BatchResponse{}, err
+	}
+	if len(stored) == 0 {
+		return BatchResponse{}, database.ErrNotFound
+	}
+
+	batch := BatchResponse{
+		ID:     id,
+		Status: BatchFinished,
+		Counts: make(map[string]int),
+		Tasks:  make([]TaskResponse, 0, len(stored)),
+		Known:  make([]KnownResponse, 0),
+	}
+	for _, s := range stored {
+		task, err := r.Task(s.ID)
+		if err != nil {
+			task = newTaskResponseFromStored(s)
+		}
+
+		batch.Counts[task.Status]++
+		if task.Status == Waiting.String() || task.Status == Processing.String() {
+			batch.Status = BatchPending
+		}
+		batch.Tasks = append(batch.Tasks, task)
+	}
+
+	return batch, nil
+}
+
+func (r *Registry) HandleBatch(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		logger.WithError(err).WithField("id", vars["id"]).Error("Failed to parse batch ID")
+		helper.E(w, http.StatusBadRequest)
+		return
+	}
+
+	batch, err := r.Batch(id)
+	if errors.Is(err, database.ErrNotFound) {
+		helper.E(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WithError(err).WithField("id", id).Error("Failed to get batch")
+		helper.E(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, batch)
+}
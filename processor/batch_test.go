@@ -0,0 +1,239 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type archiveEntry struct {
+	name string
+	data []byte
+	// size is declared instead of the real size of data if it's set
+	size int64
+}
+
+func zipArchive(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		if entry.size > 0 {
+			w, err := zw.CreateRaw(&zip.FileHeader{Name: entry.name, Method: zip.Store, CompressedSize64: uint64(len(entry.data)), UncompressedSize64: uint64(entry.size)})
+			if err != nil {
+				t.Fatalf("Failed to create zip entry: %v", err)
+			}
+			w.Write(entry.data) // nolint
+			continue
+		}
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		w.Write(entry.data) // nolint
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// tarArchive stops right after an entry with a declared size, the rest of it never has to be read
+func tarArchive(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		size := int64(len(entry.data))
+		if entry.size > 0 {
+			size = entry.size
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: size, Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		tw.Write(entry.data) // nolint
+		if entry.size > 0 {
+			return buf.Bytes()
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close tar: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(data) // nolint
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestExtractBatch(t *testing.T) {
+	replay := zipArchive(t, []archiveEntry{{name: "replay.xml", data: []byte("<Replay/>")}})
+	replays := func(n int) []archiveEntry {
+		entries := make([]archiveEntry, 0, n+1)
+		for i := 0; i < n; i++ {
+			entries = append(entries, archiveEntry{name: filepath.Join("season", string(rune('a'+i))+".bbrz"), data: replay})
+		}
+		return append(entries, archiveEntry{name: "readme.txt", data: []byte("not a replay")})
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		entries int
+		err     error
+	}{
+		{"single replay", replay, 0, nil},
+		{"zip", zipArchive(t, replays(3)), 3, nil},
+		{"zip without replays", zipArchive(t, replays(0)), 0, nil},
+		{"zip with more replays than the queue holds", zipArchive(t, replays(4)), 4, nil},
+		{"zip that unpacks too large", zipArchive(t, []archiveEntry{{name: "a.bbrz", data: replay, size: maxBatchSize + 1}}), 0, ErrBatchOversized},
+		{"tar", tarArchive(t, replays(3)), 3, nil},
+		{"tar.gz", gzipped(t, tarArchive(t, replays(3))), 3, nil},
+		{"gzipped replay", gzipped(t, []byte("<Replay/>")), 0, nil},
+		{"tar.gz with more replays than the queue holds", gzipped(t, tarArchive(t, replays(4))), 4, nil},
+		{"tar.gz that unpacks too large", gzipped(t, tarArchive(t, []archiveEntry{{name: "a.bbrz", data: replay, size: maxBatchSize + 1}})), 0, ErrBatchOversized},
+	}
+
+	previous := QueueSize()
+	SetQueueSize(3)
+	t.Cleanup(func() { SetQueueSize(previous) })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetSpoolPath(t.TempDir())
+			upload := spool(t, "upload", tt.data)
+
+			entries, err := extractBatch(upload)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("extractBatch() error = %v, want %v", err, tt.err)
+			}
+			if len(entries) != tt.entries {
+				t.Errorf("extractBatch() returned %d entries, want %d", len(entries), tt.entries)
+			}
+			for _, entry := range entries {
+				data, err := os.ReadFile(entry.Filename)
+				if err != nil || !bytes.Equal(data, replay) {
+					t.Errorf("entry %s wasn't extracted: %v", entry.Name, err)
+				}
+			}
+
+			// Nothing but the upload itself is left in the spool if the batch was turned away
+			if files, _ := os.ReadDir(SpoolPath()); len(files) != tt.entries+1 {
+				t.Errorf("%d files in the spool, want %d", len(files), tt.entries+1)
+			}
+		})
+	}
+}
+
+func TestSpoolEntryBudget(t *testing.T) {
+	SetSpoolPath(t.TempDir())
+
+	tests := []struct {
+		name   string
+		size   int
+		budget int64
+		err    error
+	}{
+		{"within budget", 10, maxBatchSize, nil},
+		{"exactly the budget", 10, 10, nil},
+		{"over the budget", 11, 10, ErrBatchOversized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, n, err := spoolEntry("a.bbrz", bytes.NewReader(make([]byte, tt.size)), tt.budget)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("spoolEntry() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && n != int64(tt.size) {
+				t.Errorf("spoolEntry() = %d bytes, want %d", n, tt.size)
+			}
+		})
+	}
+}
+
+func TestHandleBulkUpload(t *testing.T) {
+	previous := QueueSize()
+	SetQueueSize(3)
+	t.Cleanup(func() { SetQueueSize(previous) })
+
+	season := []archiveEntry{
+		{name: "match.bbrz", data: readFixture(t, "match.xml")},
+		{name: "conceded.bbrz", data: readFixture(t, "conceded.xml")},
+		{name: "disconnect.bbrz", data: readFixture(t, "disconnect.xml")},
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		code  int
+		tasks int
+		known int
+	}{
+		{"season", zipArchive(t, season), http.StatusAccepted, 3, 0},
+		{"same replay twice", zipArchive(t, append(season[:1:1], season[0])), http.StatusAccepted, 1, 1},
+		{"more replays than the queue holds", zipArchive(t, append(season, archiveEntry{name: "admin.bbrz", data: readFixture(t, "admin.xml")})), http.StatusAccepted, 4, 0},
+		{"tar.gz that unpacks too large", gzipped(t, tarArchive(t, []archiveEntry{{name: "a.bbrz", data: []byte("x"), size: maxBatchSize + 1}})), http.StatusRequestEntityTooLarge, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRegistry(t, newTaskDB(), newMemBlobs())
+
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			fw, _ := mw.CreateFormFile("replay", "season.zip")
+			fw.Write(tt.data) // nolint
+			mw.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			w := httptest.NewRecorder()
+			r.HandleProcessRequest(w, req)
+
+			if w.Code != tt.code {
+				t.Fatalf("POST /upload = %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			if tt.code != http.StatusAccepted {
+				if files, _ := os.ReadDir(SpoolPath()); len(files) != 0 {
+					t.Errorf("%d files left in the spool, want none", len(files))
+				}
+				return
+			}
+
+			var batch BatchResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &batch); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if w.Header().Get("Location") != BatchLocation(batch.ID) {
+				t.Errorf("Location = %s, want %s", w.Header().Get("Location"), BatchLocation(batch.ID))
+			}
+			if len(batch.Tasks) != tt.tasks || len(batch.Known) != tt.known {
+				t.Errorf("batch has %d tasks and %d known entries, want %d and %d", len(batch.Tasks), len(batch.Known), tt.tasks, tt.known)
+			}
+
+			// Every task gets its turn once the queue drains
+			waitFor(t, "batch to finish", func() bool {
+				batch, err := r.Batch(batch.ID)
+				return err == nil && batch.Status == BatchFinished
+			})
+		})
+	}
+}
@@ -4,6 +4,12 @@ import "time"
 
 var (
 	taskInterval time.Duration = 1 * time.Second
+	spoolPath    string        = "/var/spool/gobblerd"
+	workerCount  int           = 4
+	queueSize    int           = 100
+
+	watchPaths    []string
+	watchInterval time.Duration = 10 * time.Second
 )
 
 func TaskInterval() time.Duration {
@@ -13,3 +19,48 @@ func TaskInterval() time.Duration {
 func SetTaskInterval(newInterval time.Duration) {
 	taskInterval = newInterval
 }
+
+// SpoolPath is where uploads are kept until they're processed, it has to
+// survive a restart for queued tasks to be resumed
+func SpoolPath() string {
+	return spoolPath
+}
+
+func SetSpoolPath(newPath string) {
+	spoolPath = newPath
+}
+
+// Workers is the number of tasks processed at the same time
+func Workers() int {
+	return workerCount
+}
+
+func SetWorkers(newWorkers int) {
+	workerCount = newWorkers
+}
+
+// QueueSize is the number of tasks that can wait for a worker before uploads are turned away
+func QueueSize() int {
+	return queueSize
+}
+
+func SetQueueSize(newSize int) {
+	queueSize = newSize
+}
+
+// WatchPaths are the drop folders new replays are picked up from
+func WatchPaths() []string {
+	return watchPaths
+}
+
+func SetWatchPaths(newPaths []string) {
+	watchPaths = newPaths
+}
+
+func WatchInterval() time.Duration {
+	return watchInterval
+}
+
+func SetWatchInterval(newInterval time.Duration) {
+	watchInterval = newInterval
+}
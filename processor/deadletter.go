@@ -0,0 +1,250 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/helper"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrNotDead = errors.New("Task is not dead-lettered")
+
+// Retry puts a dead-lettered task back in the queue with a fresh set of attempts.
+// If its file has been stored since, the task is finished with that replay and
+// a *KnownError is returned instead.
+func (r *Registry) Retry(id uuid.UUID) error {
+	if err := r.Accepting(); err != nil {
+		return err
+	}
+
+	// The task goes back to waiting under the same lock as new uploads are
+	// checked with, so two retries of it can't both queue it
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	stored, err := r.deadLetter(id)
+	if err != nil {
+		return err
+	}
+
+	if stored.ContentKey != "" {
+		if err := r.checkKnown(stored.ContentKey); err != nil {
+			var known *KnownError
+			if errors.As(err, &known) && known.ReplayID != uuid.Nil {
+				r.persist(Task{
+					ID:         stored.ID,
+					Filename:   stored.Filename,
+					Name:       stored.Name,
+					ContentKey: stored.ContentKey,
+					BatchID:    stored.BatchID,
+					Status:     OK,
+					Attempts:   stored.Attempts,
+					ReplayID:   known.ReplayID,
+				})
+			}
+			return err
+		}
+	}
+
+	if err := r.restoreSpooled(stored); err != nil {
+		return err
+	}
+
+	task := Task{
+		ID:         stored.ID,
+		Filename:   stored.Filename,
+		Name:       stored.Name,
+		ContentKey: stored.ContentKey,
+		BatchID:    stored.BatchID,
+		Status:     Waiting,
+	}
+	if err := r.db.UpdateTask(task.persisted()); err != nil {
+		return fmt.Errorf("Failed to persist task: %w", err)
+	}
+	r.tasks.Add(task)
+	r.publishTask(task)
+	r.updateQueueDepth()
+
+	logger.WithField("id", id.String()).Info("Retrying dead-lettered task")
+	return nil
+}
+
+// Discard gives up on a dead-lettered task for good and removes its spooled
+// file, along with the copy in the blob store if nothing else needs it
+func (r *Registry) Discard(id uuid.UUID) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	stored, err := r.deadLetter(id)
+	if err != nil {
+		return err
+	}
+
+	if isSpooled(stored.Filename) {
+		if err := os.Remove(stored.Filename); err != nil && !os.IsNotExist(err) {
+			logger.WithError(err).WithField("filename", stored.Filename).Warn("Failed to remove spooled file")
+		}
+	}
+
+	task := Task{
+		ID:         stored.ID,
+		Filename:   stored.Filename,
+		Name:       stored.Name,
+		ContentKey: stored.ContentKey,
+		BatchID:    stored.BatchID,
+		Status:     Discarded,
+		ErrorClass: ErrorClass(stored.Class),
+		Attempts:   stored.Attempts,
+	}
+	if stored.Error != "" {
+		task.Error = errors.New(stored.Error)
+	}
+	r.persist(task)
+	r.discardBlob(stored)
+
+	logger.WithField("id", id.String()).Info("Discarded dead-lettered task")
+	return nil
+}
+
+// discardBlob removes the file kept for a discarded task unless a replay was
+// parsed from it or another task still has it, the caller holds r.mx
+func (r *Registry) discardBlob(task database.Task) {
+	if task.ContentKey == "" {
+		return
+	}
+	loggerContext := logger.WithFields(log.Fields{
+		"id":  task.ID.String(),
+		"key": task.ContentKey,
+	})
+
+	inFlight := false
+	r.tasks.Range(func(id uuid.UUID, t Task) {
+		inFlight = inFlight || t.ContentKey == task.ContentKey
+	})
+	if inFlight {
+		return
+	}
+
+	_, err := r.db.GetReplayByOriginal(task.ContentKey)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		loggerContext.WithError(err).Warn("Failed to look up replay of discarded file, keeping it")
+		return
+	}
+
+	dead, err := r.db.GetTasks(Dead.String())
+	if err != nil {
+		loggerContext.WithError(err).Warn("Failed to look up dead-lettered tasks, keeping discarded file")
+		return
+	}
+	for _, other := range dead {
+		if other.ID != task.ID && other.ContentKey == task.ContentKey {
+			return
+		}
+	}
+
+	if err := r.blobs.Delete(task.ContentKey); err != nil {
+		loggerContext.WithError(err).Warn("Failed to remove discarded file")
+	}
+}
+
+// restoreSpooled puts the upload of a dead-lettered task back into the spool
+// from the blob store, where it was kept when the task died
+func (r *Registry) restoreSpooled(task database.Task) error {
+	if !isSpooled(task.Filename) || task.ContentKey == "" {
+		return nil
+	}
+	if _, err := os.Stat(task.Filename); err == nil {
+		return nil
+	}
+
+	blob, err := r.blobs.Get(task.ContentKey)
+	if err != nil {
+		return fmt.Errorf("Failed to get file of task %s: %w", task.ID.String(), err)
+	}
+	defer blob.Close()
+
+	f, err := os.Create(task.Filename)
+	if err != nil {
+		return fmt.Errorf("Failed to create destination file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, blob); err != nil {
+		os.Remove(task.Filename) // nolint
+		return fmt.Errorf("Failed to restore file of task %s: %w", task.ID.String(), err)
+	}
+	return nil
+}
+
+func (r *Registry) deadLetter(id uuid.UUID) (database.Task, error) {
+	stored, err := r.db.GetTask(id)
+	if err != nil {
+		return database.Task{}, err
+	}
+	if stored.Status != Dead.String() {
+		return database.Task{}, ErrNotDead
+	}
+	return stored, nil
+}
+
+func (r *Registry) HandleDeadLetterList(w http.ResponseWriter, req *http.Request) {
+	tasks, err := r.Tasks(Dead.String())
+	if err != nil {
+		logger.WithError(err).Error("Failed to get dead-lettered tasks")
+		helper.E(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+func (r *Registry) HandleDeadLetterRetry(w http.ResponseWriter, req *http.Request) {
+	r.handleDeadLetter(w, req, r.Retry)
+}
+
+func (r *Registry) HandleDeadLetterDiscard(w http.ResponseWriter, req *http.Request) {
+	r.handleDeadLetter(w, req, r.Discard)
+}
+
+func (r *Registry) handleDeadLetter(w http.ResponseWriter, req *http.Request, action func(id uuid.UUID) error) {
+	vars := mux.Vars(req)
+
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		logger.WithError(err).WithField("id", vars["id"]).Error("Failed to parse task ID")
+		helper.E(w, http.StatusBadRequest)
+		return
+	}
+
+	if err := action(id); err != nil {
+		var known *KnownError
+		switch {
+		case errors.As(err, &known):
+			task, _ := r.Task(id)
+			writeKnown(w, task.Name, known)
+		case errors.Is(err, database.ErrNotFound):
+			helper.E(w, http.StatusNotFound)
+		case errors.Is(err, ErrNotDead):
+			helper.E(w, http.StatusConflict)
+		case errors.Is(err, ErrStopped), errors.Is(err, ErrQueueFull):
+			rejectRequest(w, err)
+		default:
+			logger.WithError(err).WithField("id", id).Error("Failed to handle dead-lettered task")
+			helper.E(w, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,200 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/gobbler-inc/gobblerd/storage"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestHandleDeadLetterRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    Status
+		stored    bool
+		queueSize int
+		code      int
+	}{
+		{"dead", Dead, true, 100, http.StatusNoContent},
+		{"queue is full", Dead, true, 0, http.StatusTooManyRequests},
+		{"not dead", Failed, true, 100, http.StatusConflict},
+		{"unknown", Dead, false, 100, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := QueueSize()
+			SetQueueSize(tt.queueSize)
+			t.Cleanup(func() { SetQueueSize(previous) })
+
+			db := newTaskDB()
+			r := newTestRegistry(t, db, newMemBlobs())
+
+			id := uuid.New()
+			if tt.stored {
+				db.UpdateTask(database.Task{ID: id, Filename: "/nowhere/upload.bbrz", Status: tt.status.String()}) // nolint
+			}
+
+			router := mux.NewRouter()
+			router.HandleFunc("/api/admin/dead-letters/{id}/retry", r.HandleDeadLetterRetry)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/admin/dead-letters/"+id.String()+"/retry", nil))
+
+			if w.Code != tt.code {
+				t.Errorf("POST retry = %d, want %d", w.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestRetryAfterStop(t *testing.T) {
+	SetSpoolPath(t.TempDir())
+
+	db := newTaskDB()
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	r := NewRegistry(db, newMemBlobs(), wg)
+	r.Stop()
+	wg.Wait()
+
+	id := uuid.New()
+	db.UpdateTask(database.Task{ID: id, Status: Dead.String()}) // nolint
+	if err := r.Retry(id); !errors.Is(err, ErrStopped) {
+		t.Errorf("Retry() = %v, want %v", err, ErrStopped)
+	}
+}
+
+func TestRetryStoredSince(t *testing.T) {
+	db := newTaskDB()
+	r := newTestRegistry(t, db, newMemBlobs())
+
+	key := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	replayID := uuid.New()
+	db.SaveReplay(parser.Record{ID: replayID, Original: key}) // nolint
+	id := uuid.New()
+	db.UpdateTask(database.Task{ID: id, Name: "upload.bbrz", ContentKey: key, Status: Dead.String(), Attempts: 3}) // nolint
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/admin/dead-letters/{id}/retry", r.HandleDeadLetterRetry)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/admin/dead-letters/"+id.String()+"/retry", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST retry = %d, want %d", w.Code, http.StatusOK)
+	}
+	var res KnownResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if res.Name != "upload.bbrz" || res.ReplayID == nil || *res.ReplayID != replayID {
+		t.Errorf("POST retry = %+v, want the stored replay %s", res, replayID)
+	}
+
+	task, _ := db.GetTask(id)
+	if task.Status != OK.String() || task.ReplayID != replayID {
+		t.Errorf("task = %s with replay %s, want ok with replay %s", task.Status, task.ReplayID, replayID)
+	}
+}
+
+// slowTaskDB answers task lookups late so concurrent requests act on the same state
+type slowTaskDB struct {
+	*taskDB
+}
+
+func (db slowTaskDB) GetTask(id uuid.UUID) (database.Task, error) {
+	task, err := db.taskDB.GetTask(id)
+	time.Sleep(10 * time.Millisecond)
+	return task, err
+}
+
+func TestRetryConcurrent(t *testing.T) {
+	db := newTaskDB()
+	blobs := newMemBlobs()
+	r := newTestRegistry(t, slowTaskDB{db}, blobs)
+
+	filename := spool(t, "upload.bbrz", readFixture(t, "match.xml"))
+	key, err := storage.Store(blobs, filename)
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	id := uuid.New()
+	db.UpdateTask(database.Task{ID: id, Filename: filename, Name: "upload.bbrz", ContentKey: key, Status: Dead.String()}) // nolint
+
+	errs := make(chan error, 8)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- r.Retry(id)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	retried := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			retried++
+		case !errors.Is(err, ErrNotDead):
+			t.Errorf("Retry() = %v, want nil or %v", err, ErrNotDead)
+		}
+	}
+	if retried != 1 {
+		t.Errorf("task was retried %d times, want once", retried)
+	}
+	waitFor(t, "task to finish", func() bool { return db.status(id) == OK.String() })
+}
+
+func TestDiscard(t *testing.T) {
+	data := []byte("not a replay")
+	key, _ := storage.Key(bytes.NewReader(data))
+
+	tests := []struct {
+		name    string
+		prepare func(db *taskDB)
+		kept    bool
+	}{
+		{"unused", func(db *taskDB) {}, false},
+		{"stored as a replay", func(db *taskDB) {
+			db.SaveReplay(parser.Record{ID: uuid.New(), Original: key}) // nolint
+		}, true},
+		{"another dead task", func(db *taskDB) {
+			db.UpdateTask(database.Task{ID: uuid.New(), ContentKey: key, Status: Dead.String()}) // nolint
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTaskDB()
+			blobs := newMemBlobs()
+			r := newTestRegistry(t, db, blobs)
+
+			blobs.Put(key, bytes.NewReader(data), int64(len(data))) // nolint
+			id := uuid.New()
+			db.UpdateTask(database.Task{ID: id, Filename: "/nowhere/upload.bbrz", ContentKey: key, Status: Dead.String()}) // nolint
+			tt.prepare(db)
+
+			if err := r.Discard(id); err != nil {
+				t.Fatalf("Discard() error = %v", err)
+			}
+			if status := db.status(id); status != Discarded.String() {
+				t.Errorf("status = %s, want %s", status, Discarded)
+			}
+			if exists, _ := blobs.Exists(key); exists != tt.kept {
+				t.Errorf("blob kept = %v, want %v", exists, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/google/uuid"
+)
+
+// Known is the status of an upload that wasn't queued because the same file
+// is already stored or waiting to be processed
+const Known = "known"
+
+// KnownError is returned when a file is queued that's already known, or when
+// the replay in it turns out to be stored already once it's parsed. Only one
+// of the IDs is set, TaskID while the earlier upload is in flight and ReplayID
+// once it's stored.
+type KnownError struct {
+	Key      string
+	TaskID   uuid.UUID
+	ReplayID uuid.UUID
+}
+
+func (e *KnownError) Error() string {
+	if e.ReplayID != uuid.Nil {
+		return fmt.Sprintf("File %s is already stored as replay %s", e.Key, e.ReplayID.String())
+	}
+	return fmt.Sprintf("File %s is already queued as task %s", e.Key, e.TaskID.String())
+}
+
+// KnownResponse answers an upload of a known file with where to find it instead
+type KnownResponse struct {
+	Name     string
+	Status   string
+	TaskID   *uuid.UUID
+	ReplayID *uuid.UUID
+}
+
+func newKnownResponse(name string, known *KnownError) KnownResponse {
+	res := KnownResponse{
+		Name:   name,
+		Status: Known,
+	}
+	if known.TaskID != uuid.Nil {
+		res.TaskID = &known.TaskID
+	}
+	if known.ReplayID != uuid.Nil {
+		res.ReplayID = &known.ReplayID
+	}
+	return res
+}
+
+// Location is where the known file can be followed, the replay if it's stored already
+func (k KnownResponse) Location() string {
+	if k.ReplayID != nil {
+		return fmt.Sprintf("/api/replays/%s", k.ReplayID.String())
+	}
+	return TaskLocation(*k.TaskID)
+}
+
+// checkKnown looks for the file among the tasks in flight and the stored
+// replays, the caller holds r.mx
+func (r *Registry) checkKnown(key string) error {
+	var taskID uuid.UUID
+	r.tasks.Range(func(id uuid.UUID, t Task) {
+		if t.ContentKey == key {
+			taskID = id
+		}
+	})
+	if taskID != uuid.Nil {
+		knownCount.Add(1)
+		return &KnownError{Key: key, TaskID: taskID}
+	}
+
+	replayID, err := r.db.GetReplayByOriginal(key)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to look up replay of file %s: %w", key, err)
+	}
+
+	knownCount.Add(1)
+	return &KnownError{Key: key, ReplayID: replayID}
+}
+
+// checkStored looks for a stored replay parsed from the same content as the
+// record, key is the file the record was parsed from
+func (r *Registry) checkStored(key string, record parser.Record) error {
+	replayID, err := r.db.GetReplayByContent(record)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to look up replay %s: %w", record.ID.String(), err)
+	}
+
+	knownCount.Add(1)
+	return &KnownError{Key: key, ReplayID: replayID}
+}
+
+func writeKnown(w http.ResponseWriter, name string, known *KnownError) {
+	res := newKnownResponse(name, known)
+	w.Header().Set("Location", res.Location())
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/parser"
+)
+
+// racingDB stores the replay for another task right before it's saved
+type racingDB struct {
+	*taskDB
+}
+
+func (db racingDB) SaveReplay(record parser.Record) error {
+	db.taskDB.SaveReplay(record) // nolint
+	return db.taskDB.SaveReplay(record)
+}
+
+func TestKnownFile(t *testing.T) {
+	db := newTaskDB()
+	r := newTestRegistry(t, db, newMemBlobs())
+
+	first, err := r.ProcessFile(spool(t, "first.bbrz", readFixture(t, "match.xml")))
+	if err != nil {
+		t.Fatalf("ProcessFile() error = %v", err)
+	}
+
+	// Queued already
+	var known *KnownError
+	_, err = r.ProcessFile(spool(t, "second.bbrz", readFixture(t, "match.xml")))
+	if !errors.As(err, &known) || known.TaskID != first {
+		t.Fatalf("ProcessFile() error = %v, want the queued task %s", err, first)
+	}
+	waitFor(t, "task to finish", func() bool { return db.status(first) == OK.String() })
+
+	// Stored already
+	stored, _ := db.GetTask(first)
+	_, err = r.ProcessFile(spool(t, "third.bbrz", readFixture(t, "match.xml")))
+	if !errors.As(err, &known) || known.ReplayID != stored.ReplayID {
+		t.Fatalf("ProcessFile() error = %v, want the stored replay %s", err, stored.ReplayID)
+	}
+}
+
+func TestKnownReplay(t *testing.T) {
+	record, err := parser.Parse(bytes.NewReader(readFixture(t, "match.xml")))
+	if err != nil {
+		t.Fatalf("Failed to parse fixture: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		racing bool
+	}{
+		{"stored before", false},
+		{"stored while saving", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tdb := newTaskDB()
+			var db database.DB = tdb
+			if tt.racing {
+				db = racingDB{tdb}
+			} else {
+				tdb.SaveReplay(record) // nolint
+			}
+			r := newTestRegistry(t, db, newMemBlobs())
+
+			// The same replay packed differently is a different file
+			id, err := r.ProcessFile(spool(t, "upload.bbrz", gzipped(t, readFixture(t, "match.xml"))))
+			if err != nil {
+				t.Fatalf("ProcessFile() error = %v", err)
+			}
+			waitFor(t, "task to finish", func() bool {
+				status := tdb.status(id)
+				return status != Waiting.String() && status != Processing.String()
+			})
+
+			task, _ := tdb.GetTask(id)
+			if task.Status != OK.String() || task.ReplayID != record.ID {
+				t.Errorf("task = %s with replay %s, want ok with replay %s: %s", task.Status, task.ReplayID, record.ID, task.Error)
+			}
+			if originals, _ := tdb.GetOriginals(database.ReplayFilter{}); len(originals) != 1 {
+				t.Errorf("%d replays stored, want 1", len(originals))
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gobbler-inc/gobblerd/helper"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/google/uuid"
+)
+
+type EventKind string
+
+const (
+	// EventTask is sent on every status change of a task
+	EventTask EventKind = "task"
+	// EventReplay is sent when a replay has been stored
+	EventReplay EventKind = "replay"
+	// EventReprocess is sent as a reprocessing job makes progress
+	EventReprocess EventKind = "reprocess"
+)
+
+const (
+	// eventHistorySize is how many events are kept for clients that reconnect with Last-Event-ID
+	eventHistorySize = 256
+	// subscriberBuffer is how far a client can fall behind before it's dropped
+	subscriberBuffer  = 64
+	eventHeartbeat    = 15 * time.Second
+	eventWriteTimeout = 10 * time.Second
+)
+
+type Event struct {
+	ID        uint64
+	Kind      EventKind
+	Task      *TaskResponse
+	Replay    *ReplayEvent
+	Reprocess *ReprocessJob
+}
+
+// ReplayEvent is a short summary of a stored replay, the full record is at /api/replays/{id}
+type ReplayEvent struct {
+	ReplayID  uuid.UUID
+	TaskID    uuid.UUID
+	SeriesID  uuid.UUID
+	Home      string
+	Away      string
+	HomeScore int
+	AwayScore int
+	Partial   bool
+}
+
+func newReplayEvent(taskID uuid.UUID, record parser.Record) *ReplayEvent {
+	return &ReplayEvent{
+		ReplayID:  record.ID,
+		TaskID:    taskID,
+		SeriesID:  record.SeriesID,
+		Home:      record.Home.Name,
+		Away:      record.Away.Name,
+		HomeScore: record.Home.Score,
+		AwayScore: record.Away.Score,
+		Partial:   record.Partial,
+	}
+}
+
+// broker fans events out to the connected clients. Slow clients are dropped
+// instead of holding up the processor, they can reconnect and catch up from the history.
+type broker struct {
+	mx          *sync.Mutex
+	lastID      uint64
+	history     []Event
+	subscribers map[chan Event]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{
+		mx:          &sync.Mutex{},
+		history:     make([]Event, 0, eventHistorySize),
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+func (b *broker) publish(evt Event) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.lastID++
+	evt.ID = b.lastID
+
+	if len(b.history) == eventHistorySize {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, evt)
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- evt:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the channel new events arrive on and the events after lastID that are still known
+func (b *broker) subscribe(lastID uint64) (chan Event, []Event) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	backlog := make([]Event, 0)
+	if lastID > 0 {
+		for _, evt := range b.history {
+			if evt.ID > lastID {
+				backlog = append(backlog, evt)
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+	return ch, backlog
+}
+
+func (b *broker) unsubscribe(ch chan Event) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (r *Registry) publishTask(task Task) {
+	res := newTaskResponse(task)
+	r.events.publish(Event{Kind: EventTask, Task: &res})
+}
+
+func (r *Registry) publishReplay(taskID uuid.UUID, record parser.Record) {
+	r.events.publish(Event{Kind: EventReplay, Replay: newReplayEvent(taskID, record)})
+}
+
+// HandleTaskEvents streams task changes, stored replays and the progress of
+// reprocessing jobs as server-sent events.
+// The server's write timeout would cut the stream off after a few seconds so
+// the connection is taken over and given a deadline per write instead.
+func (r *Registry) HandleTaskEvents(w http.ResponseWriter, req *http.Request) {
+	lastID, _ := strconv.ParseUint(req.Header.Get("Last-Event-ID"), 10, 64)
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		logger.Error("Connection doesn't support streaming events")
+		helper.E(w, http.StatusInternalServerError)
+		return
+	}
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		logger.WithError(err).Error("Failed to take over connection")
+		return
+	}
+	defer conn.Close()
+
+	// Subscribe before the client sees the stream open so nothing published in between is lost
+	events, backlog := r.events.subscribe(lastID)
+	defer r.events.unsubscribe(events)
+
+	stream := &eventStream{conn: conn, w: buf.Writer}
+	header := "HTTP/1.1 200 OK\r\n" +
+		"Content-Type: text/event-stream\r\n" +
+		"Cache-Control: no-cache\r\n" +
+		"Access-Control-Allow-Origin: *\r\n" +
+		"Connection: close\r\n\r\n"
+	if err := stream.write(header); err != nil {
+		return
+	}
+
+	for _, evt := range backlog {
+		if err := stream.send(evt); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := stream.send(evt); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			// Comments keep proxies from closing an idle stream and tell us when the client is gone
+			if err := stream.write(": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.stopping:
+			return
+		}
+	}
+}
+
+type eventStream struct {
+	conn net.Conn
+	w    *bufio.Writer
+}
+
+func (s *eventStream) send(evt Event) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		logger.WithError(err).Error("Failed to encode event")
+		return nil
+	}
+	return s.write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", evt.ID, evt.Kind, data))
+}
+
+func (s *eventStream) write(msg string) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout)); err != nil {
+		return err
+	}
+	if _, err := s.w.WriteString(msg); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
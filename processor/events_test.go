@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBrokerBacklog(t *testing.T) {
+	b := newBroker()
+	for i := 0; i < eventHistorySize+10; i++ {
+		b.publish(Event{Kind: EventTask})
+	}
+
+	tests := []struct {
+		name   string
+		lastID uint64
+		want   int
+	}{
+		{"new client", 0, 0},
+		{"up to date", eventHistorySize + 10, 0},
+		{"a few behind", eventHistorySize + 7, 3},
+		{"behind the history", 1, eventHistorySize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, backlog := b.subscribe(tt.lastID)
+			defer b.unsubscribe(ch)
+
+			if len(backlog) != tt.want {
+				t.Fatalf("subscribe(%d) returned %d events, want %d", tt.lastID, len(backlog), tt.want)
+			}
+			for i := 1; i < len(backlog); i++ {
+				if backlog[i].ID != backlog[i-1].ID+1 {
+					t.Errorf("backlog is out of order at %d: %d after %d", i, backlog[i].ID, backlog[i-1].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	b := newBroker()
+	slow, _ := b.subscribe(0)
+	fast, _ := b.subscribe(0)
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.publish(Event{Kind: EventTask})
+		<-fast
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("slow subscriber received %d events before it was dropped, want %d", received, subscriberBuffer)
+	}
+
+	b.publish(Event{Kind: EventTask})
+	if evt := <-fast; evt.ID != subscriberBuffer+2 {
+		t.Errorf("fast subscriber got event %d, want %d", evt.ID, subscriberBuffer+2)
+	}
+
+	// Unsubscribing a dropped client must not close its channel twice
+	b.unsubscribe(slow)
+	b.unsubscribe(fast)
+}
+
+// readEvents collects the events of the stream until n arrived
+func readEvents(t *testing.T, res *http.Response, n int) []Event {
+	t.Helper()
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			data := strings.TrimPrefix(scanner.Text(), "data: ")
+			if data == scanner.Text() {
+				continue
+			}
+			var evt Event
+			if err := json.Unmarshal([]byte(data), &evt); err != nil {
+				t.Errorf("Failed to decode event %s: %v", data, err)
+				return
+			}
+			events <- evt
+		}
+	}()
+
+	result := make([]Event, 0, n)
+	timeout := time.After(5 * time.Second)
+	for len(result) < n {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				t.Fatalf("Stream ended after %d events, want %d", len(result), n)
+			}
+			result = append(result, evt)
+		case <-timeout:
+			t.Fatalf("Timed out after %d events, want %d", len(result), n)
+		}
+	}
+	return result
+}
+
+func TestHandleTaskEvents(t *testing.T) {
+	db := newTaskDB()
+	r := newTestRegistry(t, db, newMemBlobs())
+
+	srv := httptest.NewServer(http.HandlerFunc(r.HandleTaskEvents))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %s, want text/event-stream", ct)
+	}
+
+	id, err := r.ProcessFile(spool(t, "upload.bbrz", readFixture(t, "match.xml")))
+	if err != nil {
+		t.Fatalf("ProcessFile() error = %v", err)
+	}
+
+	// waiting, processing, the stored replay and ok
+	events := readEvents(t, res, 4)
+	kinds := make([]string, 0, len(events))
+	for _, evt := range events {
+		switch evt.Kind {
+		case EventTask:
+			if evt.Task.ID != id {
+				t.Errorf("task event for %s, want %s", evt.Task.ID, id)
+			}
+			kinds = append(kinds, evt.Task.Status)
+		case EventReplay:
+			if evt.Replay.TaskID != id || evt.Replay.Home != "Reikland Reavers" {
+				t.Errorf("replay event = %+v, want the replay of task %s", evt.Replay, id)
+			}
+			kinds = append(kinds, string(evt.Kind))
+		}
+	}
+	want := "waiting processing replay ok"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+
+	// A client reconnecting with the last ID it saw catches up from the history
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Last-Event-ID", "2")
+	again, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	defer again.Body.Close()
+
+	missed := readEvents(t, again, 2)
+	if missed[0].ID != 3 || missed[1].ID != 4 {
+		t.Errorf("reconnect replayed events %d and %d, want 3 and 4", missed[0].ID, missed[1].ID)
+	}
+	if missed[1].Task == nil || missed[1].Task.ID != id {
+		t.Errorf("last missed event = %+v, want the finished task", missed[1])
+	}
+}
@@ -0,0 +1,36 @@
+package processor
+
+import "expvar"
+
+// Metrics are published under "processor" on /debug/vars
+var (
+	metrics = expvar.NewMap("processor")
+
+	queueDepth     = new(expvar.Int)
+	workers        = new(expvar.Int)
+	busyWorkers    = new(expvar.Int)
+	processedCount = new(expvar.Int)
+	failedCount    = new(expvar.Int)
+	rejectedCount  = new(expvar.Int)
+	retriedCount   = new(expvar.Int)
+	deadCount      = new(expvar.Int)
+	knownCount     = new(expvar.Int)
+)
+
+func init() {
+	metrics.Set("queue_depth", queueDepth)
+	metrics.Set("workers", workers)
+	metrics.Set("busy_workers", busyWorkers)
+	metrics.Set("processed_tasks", processedCount)
+	metrics.Set("failed_tasks", failedCount)
+	metrics.Set("rejected_tasks", rejectedCount)
+	metrics.Set("retried_tasks", retriedCount)
+	metrics.Set("dead_tasks", deadCount)
+	metrics.Set("known_uploads", knownCount)
+	metrics.Set("worker_utilization", expvar.Func(func() interface{} {
+		if workers.Value() == 0 {
+			return 0.0
+		}
+		return float64(busyWorkers.Value()) / float64(workers.Value())
+	}))
+}
@@ -1,8 +1,7 @@
 package processor
 
 import (
-	"archive/zip"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,6 +13,7 @@ import (
 	"github.com/gobbler-inc/gobblerd/database"
 	"github.com/gobbler-inc/gobblerd/helper"
 	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/gobbler-inc/gobblerd/storage"
 
 	log "github.com/sirupsen/logrus"
 
@@ -31,6 +31,10 @@ const (
 	Processing
 	OK
 	Failed
+	Partial
+	// Dead tasks failed every attempt their retry policy allowed and wait for an admin
+	Dead
+	Discarded
 )
 
 func (s Status) String() string {
@@ -43,15 +47,45 @@ func (s Status) String() string {
 		return "ok"
 	case Failed:
 		return "failed"
+	case Partial:
+		return "partial"
+	case Dead:
+		return "dead"
+	case Discarded:
+		return "discarded"
 	}
 	return "unknown"
 }
 
+func parseStatus(s string) Status {
+	for _, status := range []Status{Waiting, Processing, OK, Failed, Partial, Dead, Discarded} {
+		if status.String() == s {
+			return status
+		}
+	}
+	return Failed
+}
+
 type Task struct {
 	ID       uuid.UUID
 	Filename string
-	Status   Status
-	Error    error
+	// Name is the name the file was uploaded with
+	Name string
+	// ContentKey is the SHA-256 of the file, used to recognize the same file uploaded again
+	ContentKey string
+	BatchID    uuid.UUID
+	Status     Status
+	Error      error
+	ErrorKind  parser.ErrorKind
+	// ErrorClass decides the retry policy of a failed attempt
+	ErrorClass  ErrorClass
+	Attempts    int
+	NextAttempt time.Time
+	// ReplayID is the stored replay once the task succeeded
+	ReplayID uuid.UUID
+
+	// queued is set once the task has been handed to the workers
+	queued bool
 }
 
 type Registry struct {
@@ -59,17 +93,24 @@ type Registry struct {
 	globalWg *sync.WaitGroup
 	wg       *sync.WaitGroup
 
-	db             database.DB
-	done           chan struct{}
-	update         chan Update
-	tasks          *TaskList
-	processedTasks *TaskList
+	db          database.DB
+	blobs       storage.BlobStore
+	done        chan struct{}
+	stopping    chan struct{}
+	update      chan Update
+	queue       chan Task
+	tasks       *TaskList
+	events      *broker
+	watcher     *folderWatcher
+	reprocessor *Reprocessor
 }
 
 type Update struct {
-	TaskID uuid.UUID
-	Status Status
-	Error  error
+	TaskID   uuid.UUID
+	Status   Status
+	Error    error
+	Class    ErrorClass
+	ReplayID uuid.UUID
 }
 
 type TaskList struct {
@@ -84,10 +125,11 @@ func NewTaskList() *TaskList {
 	}
 }
 
-func (t *TaskList) Add(task *Task) {
+// Add keeps a copy of the task, changes to it go through the TaskList from then on
+func (t *TaskList) Add(task Task) {
 	t.mx.Lock()
 	defer t.mx.Unlock()
-	t.tasks[task.ID] = task
+	t.tasks[task.ID] = &task
 }
 
 func (t *TaskList) Delete(key uuid.UUID) {
@@ -96,46 +138,159 @@ func (t *TaskList) Delete(key uuid.UUID) {
 	delete(t.tasks, key)
 }
 
-func (t *TaskList) Update(update Update) {
+// Update sets the status of the task and returns what it looks like now
+func (t *TaskList) Update(update Update) (Task, bool) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	task, ok := t.tasks[update.TaskID]
+	if !ok {
+		return Task{}, false
+	}
+
+	task.Status = update.Status
+	task.Error = update.Error
+	task.ErrorKind = parser.KindOf(update.Error)
+	return *task, true
+}
+
+// Reschedule puts a failed task back to waiting if its retry policy allows
+// another attempt and returns the rescheduled task
+func (t *TaskList) Reschedule(update Update) (Task, bool) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	task, ok := t.tasks[update.TaskID]
+	if !ok {
+		return Task{}, false
+	}
+
+	task.Attempts++
+	task.Error = update.Error
+	task.ErrorKind = parser.KindOf(update.Error)
+	task.ErrorClass = update.Class
+
+	policy := RetryPolicyFor(update.Class)
+	if !policy.Retries(task.Attempts) {
+		return Task{}, false
+	}
+
+	task.Status = Waiting
+	task.NextAttempt = time.Now().Add(policy.Backoff(task.Attempts))
+	task.queued = false
+	return *task, true
+}
+
+// Finish takes the task off the list with the final state of the update applied
+func (t *TaskList) Finish(update Update) (Task, bool) {
 	t.mx.Lock()
 	defer t.mx.Unlock()
 
-	task := t.tasks[update.TaskID]
+	task, ok := t.tasks[update.TaskID]
+	if !ok {
+		return Task{}, false
+	}
+	delete(t.tasks, update.TaskID)
+
 	task.Status = update.Status
 	task.Error = update.Error
-	t.tasks[update.TaskID] = task
+	task.ErrorKind = parser.KindOf(update.Error)
+	task.ErrorClass = update.Class
+	task.ReplayID = update.ReplayID
+	return *task, true
+}
+
+// Queue hands the waiting tasks that are due to the queue for as long as there's room in it
+func (t *TaskList) Queue(now time.Time, queue chan<- Task) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	for _, task := range t.tasks {
+		if task.Status != Waiting || task.queued || now.Before(task.NextAttempt) {
+			continue
+		}
+		select {
+		case queue <- *task:
+			task.queued = true
+		default:
+			return
+		}
+	}
 }
 
-func (t *TaskList) Get(key uuid.UUID) *Task {
+// Snapshot returns a copy of the task as it is right now
+func (t *TaskList) Snapshot(key uuid.UUID) (Task, bool) {
 	t.mx.Lock()
 	defer t.mx.Unlock()
 
-	return t.tasks[key]
+	task, ok := t.tasks[key]
+	if !ok {
+		return Task{}, false
+	}
+	return *task, true
 }
 
-func (t *TaskList) Range(cb func(id uuid.UUID, t *Task)) {
+// Range calls cb with a copy of every task
+func (t *TaskList) Range(cb func(id uuid.UUID, t Task)) {
 	t.mx.Lock()
 	defer t.mx.Unlock()
 
 	for id, task := range t.tasks {
-		cb(id, task)
+		cb(id, *task)
+	}
+}
+
+// persisted converts the task to the form it's stored in the database
+func (t Task) persisted() database.Task {
+	task := database.Task{
+		ID:         t.ID,
+		Filename:   t.Filename,
+		Name:       t.Name,
+		ContentKey: t.ContentKey,
+		BatchID:    t.BatchID,
+		Status:     t.Status.String(),
+		ErrorKind:  string(t.ErrorKind),
+		Class:      string(t.ErrorClass),
+		Attempts:   t.Attempts,
+		ReplayID:   t.ReplayID,
+	}
+	if t.Status == Waiting {
+		task.NextAttempt = t.NextAttempt
+	}
+	if t.Error != nil {
+		task.Error = t.Error.Error()
 	}
+	return task
 }
 
-func NewRegistry(db database.DB, gwg *sync.WaitGroup) *Registry {
+func NewRegistry(db database.DB, blobs storage.BlobStore, gwg *sync.WaitGroup) *Registry {
 	r := &Registry{
 		mx:       &sync.Mutex{},
 		globalWg: gwg,
 		wg:       &sync.WaitGroup{},
 
-		db: db,
+		db:    db,
+		blobs: blobs,
+
+		done:        make(chan struct{}),
+		stopping:    make(chan struct{}),
+		update:      make(chan Update),
+		queue:       make(chan Task, QueueSize()),
+		tasks:       NewTaskList(),
+		events:      newBroker(),
+		watcher:     newFolderWatcher(),
+		reprocessor: NewReprocessor(db, blobs),
+	}
+	r.reprocessor.progress = r.publishReprocess
 
-		done:           make(chan struct{}),
-		update:         make(chan Update),
-		tasks:          NewTaskList(),
-		processedTasks: NewTaskList(),
+	if err := os.MkdirAll(SpoolPath(), 0755); err != nil {
+		logger.WithError(err).WithField("path", SpoolPath()).Error("Failed to create spool directory")
 	}
 
+	r.resume()
+	r.startWorkers(Workers())
+	r.startWatching()
+
 	go func() {
 		logger.WithField("interval", TaskInterval().String()).Debug("Starting task runner")
 		t := time.NewTicker(TaskInterval())
@@ -143,33 +298,32 @@ func NewRegistry(db database.DB, gwg *sync.WaitGroup) *Registry {
 			select {
 			case <-t.C:
 				logger.Trace("Looking for new tasks to pick up")
-				r.tasks.Range(func(id uuid.UUID, task *Task) {
-					if task.Status == Waiting {
-						task.Status = Processing
-						r.wg.Add(1)
-						go r.processTask(task)
-					}
-				})
+				r.fillQueue()
 			case <-r.done:
 				t.Stop()
 				logger.Info("Received stop signal, waiting for tasks to finish")
-				r.wg.Wait()
-				r.globalWg.Done()
-				return
-			case evt := <-r.update:
-				task := r.tasks.Get(evt.TaskID)
-				r.tasks.Delete(evt.TaskID)
-				task.Status = evt.Status
-				task.Error = evt.Error
-				r.processedTasks.Add(task)
-				loggerContext := logger.WithFields(log.Fields{
-					"id":     evt.TaskID.String(),
-					"status": evt.Status.String(),
-				})
-				if evt.Error != nil {
-					loggerContext = loggerContext.WithError(evt.Error)
+				// Jobs started in the background join r.wg under the same lock
+				r.mx.Lock()
+				close(r.stopping)
+				r.mx.Unlock()
+
+				// Workers still report their last task so keep handling updates until they're gone
+				finished := make(chan struct{})
+				go func() {
+					r.wg.Wait()
+					close(finished)
+				}()
+				for {
+					select {
+					case evt := <-r.update:
+						r.handleUpdate(evt)
+					case <-finished:
+						r.globalWg.Done()
+						return
+					}
 				}
-				loggerContext.Debug("Processed task")
+			case evt := <-r.update:
+				r.handleUpdate(evt)
 			}
 		}
 	}()
@@ -177,76 +331,350 @@ func NewRegistry(db database.DB, gwg *sync.WaitGroup) *Registry {
 	return r
 }
 
+func (r *Registry) handleUpdate(evt Update) {
+	if _, ok := r.tasks.Snapshot(evt.TaskID); !ok {
+		return
+	}
+
+	loggerContext := logger.WithFields(log.Fields{
+		"id":     evt.TaskID.String(),
+		"status": evt.Status.String(),
+	})
+	if evt.Error != nil {
+		loggerContext = loggerContext.WithError(evt.Error).WithFields(log.Fields{
+			"error_kind":  parser.KindOf(evt.Error),
+			"error_class": evt.Class,
+		})
+	}
+
+	if evt.Status == Failed {
+		if task, ok := r.tasks.Reschedule(evt); ok {
+			r.persist(task)
+			r.updateQueueDepth()
+			retriedCount.Add(1)
+			loggerContext.WithField("next_attempt", task.NextAttempt.Format(time.RFC3339)).Info("Task failed, retrying later")
+			return
+		}
+		if RetryPolicyFor(evt.Class).MaxAttempts > 1 {
+			evt.Status = Dead
+		}
+	}
+
+	task, ok := r.tasks.Finish(evt)
+	if !ok {
+		return
+	}
+	if evt.Status == Failed || evt.Status == Dead {
+		r.releaseSpooled(task)
+	}
+	// Finished tasks are only kept in the database from here on
+	task.Filename = r.finishWatched(task)
+	r.persist(task)
+
+	processedCount.Add(1)
+	switch evt.Status {
+	case Failed:
+		failedCount.Add(1)
+	case Dead:
+		deadCount.Add(1)
+	}
+
+	loggerContext.WithField("status", evt.Status.String()).Debug("Processed task")
+}
+
+// resume picks up the tasks a previous run didn't get to finish. Tasks that were
+// being processed when the daemon went down are started over.
+func (r *Registry) resume() {
+	pending, err := r.db.GetTasks(Waiting.String(), Processing.String())
+	if err != nil {
+		logger.WithError(err).Error("Failed to load pending tasks")
+		return
+	}
+
+	for _, stored := range pending {
+		task := Task{
+			ID:          stored.ID,
+			Filename:    stored.Filename,
+			Name:        stored.Name,
+			ContentKey:  stored.ContentKey,
+			BatchID:     stored.BatchID,
+			Status:      Waiting,
+			ErrorClass:  ErrorClass(stored.Class),
+			Attempts:    stored.Attempts,
+			NextAttempt: stored.NextAttempt,
+		}
+		if stored.Error != "" {
+			task.Error = errors.New(stored.Error)
+			task.ErrorKind = parser.ErrorKind(stored.ErrorKind)
+		}
+		if parseStatus(stored.Status) == Processing {
+			r.persist(task)
+		}
+		r.tasks.Add(task)
+	}
+	r.updateQueueDepth()
+
+	if len(pending) > 0 {
+		logger.WithField("tasks", len(pending)).Info("Resumed pending tasks")
+	}
+}
+
+// persist stores the current state of the task, the in-memory lists stay the
+// source of truth for the running daemon so a failure is only logged
+func (r *Registry) persist(task Task) {
+	r.publishTask(task)
+	if err := r.db.UpdateTask(task.persisted()); err != nil {
+		logger.WithError(err).WithFields(log.Fields{
+			"id":     task.ID.String(),
+			"status": task.Status.String(),
+		}).Error("Failed to persist task")
+	}
+}
+
 func (r *Registry) Stop() {
 	logger.Debug("Stopping task watcher")
 	r.done <- struct{}{}
 }
 
-func (r *Registry) ProcessFile(filename string) error {
+// ProcessFile queues the file and returns the ID of the new task
+func (r *Registry) ProcessFile(filename string) (uuid.UUID, error) {
+	if err := r.Accepting(); err != nil {
+		return uuid.Nil, err
+	}
+
+	return r.enqueue(filename, filepath.Base(filename), uuid.Nil)
+}
+
+// enqueue creates and persists a waiting task, the caller checks there's room
+// for it. Files that are already stored or queued return a *KnownError instead.
+func (r *Registry) enqueue(filename, name string, batchID uuid.UUID) (uuid.UUID, error) {
+	key, err := storage.FileKey(filename)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// Two uploads of the same file at the same time must not both get past the check
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if err := r.checkKnown(key); err != nil {
+		return uuid.Nil, err
+	}
+
 	id := uuid.New()
 	task := Task{
-		ID:       id,
-		Filename: filename,
-		Status:   Waiting,
+		ID:         id,
+		Filename:   filename,
+		Name:       name,
+		ContentKey: key,
+		BatchID:    batchID,
+		Status:     Waiting,
 	}
 
-	r.tasks.Add(&task)
-	return nil
+	if err := r.db.CreateTask(task.persisted()); err != nil {
+		return uuid.Nil, fmt.Errorf("Failed to persist task: %w", err)
+	}
+
+	r.tasks.Add(task)
+	r.updateQueueDepth()
+	r.publishTask(task)
+	return id, nil
 }
 
-func (r *Registry) processTask(t *Task) {
-	defer r.wg.Done()
+func (r *Registry) processTask(t Task) {
+	defer func() {
+		// A replay should never be able to take the whole daemon down with it
+		if rec := recover(); rec != nil {
+			r.update <- Update{
+				TaskID: t.ID,
+				Status: Failed,
+				Error:  fmt.Errorf("Panic while processing file: %v", rec),
+				Class:  ClassPanic,
+			}
+		}
+	}()
 	logger.WithField("filename", t.Filename).Trace("Processing file")
 
-	res, err := zip.OpenReader(t.Filename)
+	f, err := os.Open(t.Filename)
 	if err != nil {
 		r.update <- Update{
+			TaskID: t.ID,
 			Status: Failed,
 			Error:  err,
+			Class:  ClassFile,
 		}
 		return
 	}
-	defer res.Close()
+	defer f.Close()
 
-	f := res.File[0]
+	info, err := f.Stat()
+	if err != nil {
+		r.update <- Update{
+			TaskID: t.ID,
+			Status: Failed,
+			Error:  err,
+			Class:  ClassFile,
+		}
+		return
+	}
 
-	rc, err := f.Open()
+	record, err := parseFile(f, info.Size())
 	if err != nil {
+		class := ClassParse
+		if parser.KindOf(err) == "" {
+			class = ClassFile
+		}
 		r.update <- Update{
+			TaskID: t.ID,
 			Status: Failed,
 			Error:  err,
+			Class:  class,
 		}
 		return
 	}
-	defer rc.Close()
 
-	record, err := parser.Parse(rc)
+	logger.WithFields(log.Fields{
+		"filename":       t.Filename,
+		"format":         record.Format,
+		"format_version": record.FormatVersion,
+	}).Trace("Parsed file")
+
+	// A file that only differs in how it's packed parses to a replay that's stored already
+	if err := r.checkStored(t.ContentKey, record); err != nil {
+		r.finishStored(t, err)
+		return
+	}
+
+	// The original is kept so it can be downloaded and parsed again later
+	key, err := storage.Store(r.blobs, t.Filename)
 	if err != nil {
 		r.update <- Update{
 			TaskID: t.ID,
 			Status: Failed,
 			Error:  err,
+			Class:  ClassStorage,
 		}
 		return
 	}
+	record.Original = key
 
 	if err := r.db.SaveReplay(record); err != nil {
+		// The same replay may have been stored by another task in the meantime
+		var known *KnownError
+		if errors.As(r.checkStored(t.ContentKey, record), &known) {
+			r.finishStored(t, known)
+			return
+		}
+		r.update <- Update{
+			TaskID: t.ID,
+			Status: Failed,
+			Error:  err,
+			Class:  databaseErrorClass(err),
+		}
+		return
+	}
+
+	r.publishReplay(t.ID, record)
+
+	status := OK
+	if record.Partial {
+		status = Partial
+	}
+
+	removeSpooled(t.Filename)
+
+	r.update <- Update{
+		TaskID:   t.ID,
+		Status:   status,
+		Error:    nil,
+		ReplayID: record.ID,
+	}
+}
+
+// finishStored ends a task whose replay turned out to be stored already, it
+// points at the stored replay instead. Errors looking it up fail the task.
+func (r *Registry) finishStored(t Task, err error) {
+	var known *KnownError
+	if !errors.As(err, &known) {
 		r.update <- Update{
 			TaskID: t.ID,
 			Status: Failed,
 			Error:  err,
+			Class:  databaseErrorClass(err),
 		}
 		return
 	}
 
+	logger.WithFields(log.Fields{
+		"id":        t.ID.String(),
+		"replay_id": known.ReplayID.String(),
+	}).Info("Replay of task is already stored")
+	removeSpooled(t.Filename)
+
 	r.update <- Update{
-		TaskID: t.ID,
-		Status: OK,
-		Error:  nil,
+		TaskID:   t.ID,
+		Status:   OK,
+		ReplayID: known.ReplayID,
+	}
+}
+
+// removeSpooled removes an upload once it's stored, files from elsewhere are left alone
+func removeSpooled(filename string) {
+	if !isSpooled(filename) {
+		return
+	}
+	if err := os.Remove(filename); err != nil {
+		logger.WithError(err).WithField("filename", filename).Warn("Failed to remove spooled file")
+	}
+}
+
+// isSpooled reports whether the file is an upload the processor owns
+func isSpooled(filename string) bool {
+	return filepath.Dir(filename) == filepath.Clean(SpoolPath())
+}
+
+// releaseSpooled removes the upload of a task that came to an end without a
+// replay. Dead tasks can still be retried by an admin so their file is kept in
+// the blob store under its content key until then.
+func (r *Registry) releaseSpooled(task Task) {
+	if !isSpooled(task.Filename) {
+		return
+	}
+
+	loggerContext := logger.WithFields(log.Fields{
+		"id":       task.ID.String(),
+		"filename": task.Filename,
+	})
+	if task.Status == Dead {
+		if _, err := storage.Store(r.blobs, task.Filename); err != nil {
+			loggerContext.WithError(err).Warn("Failed to keep dead-lettered file, leaving it in the spool")
+			return
+		}
+	}
+
+	if err := os.Remove(task.Filename); err != nil && !os.IsNotExist(err) {
+		loggerContext.WithError(err).Warn("Failed to remove spooled file")
 	}
 }
 
+// parseFile parses the file strictly first and falls back to salvaging what it
+// can if the replay turns out to be broken
+func parseFile(f *os.File, size int64) (parser.Record, error) {
+	record, err := parser.ParseFile(f, size)
+	if err != nil && parser.KindOf(err) != "" && parser.KindOf(err) != parser.KindUnknownFormat {
+		logger.WithError(err).WithField("filename", f.Name()).Debug("Strict parsing failed, trying to salvage the replay")
+		record, err = parser.ParseFileWithOptions(f, size, parser.Options{Lenient: true})
+	}
+	return record, err
+}
+
 func (r *Registry) HandleProcessRequest(w http.ResponseWriter, req *http.Request) {
+	// Turn the upload away before reading it if it couldn't be queued anyway
+	if err := r.Accepting(); err != nil {
+		rejectRequest(w, err)
+		return
+	}
+
 	if err := req.ParseMultipartForm(MaxContentLength); err != nil {
 		logger.WithError(err).Error("Failed to process uploaded file")
 		helper.E(w, http.StatusRequestEntityTooLarge)
@@ -261,11 +689,9 @@ func (r *Registry) HandleProcessRequest(w http.ResponseWriter, req *http.Request
 	}
 	defer file.Close()
 
-	h := sha256.New()
-	h.Write([]byte(handler.Filename))
-	name := fmt.Sprintf("%x.bbrz", h.Sum(nil))
+	name := fmt.Sprintf("%s.bbrz", uuid.New().String())
 
-	resFile, err := os.Create(filepath.Join("/tmp", name))
+	resFile, err := os.Create(filepath.Join(SpoolPath(), name))
 	if err != nil {
 		logger.WithError(err).Error("Failed to create destination file")
 		helper.E(w, http.StatusInternalServerError)
@@ -275,7 +701,53 @@ func (r *Registry) HandleProcessRequest(w http.ResponseWriter, req *http.Request
 	io.Copy(resFile, file) // nolint
 	resFile.Close()
 
-	r.ProcessFile(resFile.Name()) // nolint
+	entries, err := extractBatch(resFile.Name())
+	if errors.Is(err, ErrBatchOversized) {
+		os.Remove(resFile.Name()) // nolint
+		logger.WithError(err).WithField("filename", handler.Filename).Warn("Rejected bulk upload")
+		helper.E(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		os.Remove(resFile.Name()) // nolint
+		logger.WithError(err).WithField("filename", handler.Filename).Error("Failed to extract bulk upload")
+		helper.E(w, http.StatusBadRequest)
+		return
+	}
+	if entries != nil {
+		os.Remove(resFile.Name()) // nolint
+		r.handleBatch(w, entries)
+		return
+	}
+
+	if err := r.Accepting(); err != nil {
+		os.Remove(resFile.Name()) // nolint
+		rejectRequest(w, err)
+		return
+	}
+
+	id, err := r.enqueue(resFile.Name(), handler.Filename, uuid.Nil)
+	var known *KnownError
+	if errors.As(err, &known) {
+		os.Remove(resFile.Name()) // nolint
+		logger.WithField("name", handler.Filename).Debug(known.Error())
+		writeKnown(w, handler.Filename, known)
+		return
+	}
+	if err != nil {
+		os.Remove(resFile.Name()) // nolint
+		logger.WithError(err).Error("Failed to queue uploaded file")
+		helper.E(w, http.StatusInternalServerError)
+		return
+	}
+
+	task, err := r.Task(id)
+	if err != nil {
+		logger.WithError(err).WithField("id", id).Error("Failed to get queued task")
+		helper.E(w, http.StatusInternalServerError)
+		return
+	}
 
-	w.Write([]byte("OK")) // nolint
+	w.Header().Set("Location", TaskLocation(id))
+	writeJSON(w, http.StatusAccepted, task)
 }
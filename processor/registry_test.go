@@ -0,0 +1,483 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/gobbler-inc/gobblerd/storage"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+)
+
+var errConnRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+// taskDB keeps tasks and replays in memory, everything else of database.DB is left unimplemented
+type taskDB struct {
+	database.DB
+
+	mx      sync.Mutex
+	tasks   map[uuid.UUID]database.Task
+	replays map[uuid.UUID]parser.Record
+	// saveErrs are returned by SaveReplay one after the other before it succeeds
+	saveErrs []error
+}
+
+func newTaskDB() *taskDB {
+	return &taskDB{
+		tasks:   make(map[uuid.UUID]database.Task),
+		replays: make(map[uuid.UUID]parser.Record),
+	}
+}
+
+func (db *taskDB) SaveReplay(record parser.Record) error {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	if len(db.saveErrs) > 0 {
+		err := db.saveErrs[0]
+		db.saveErrs = db.saveErrs[1:]
+		return err
+	}
+	if _, ok := db.replays[record.ID]; ok {
+		return &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint \"replays_pkey\""}
+	}
+	db.replays[record.ID] = record
+	return nil
+}
+
+func (db *taskDB) UpdateReplay(record parser.Record) error {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	if _, ok := db.replays[record.ID]; !ok {
+		return database.ErrNotFound
+	}
+	db.replays[record.ID] = record
+	return nil
+}
+
+func (db *taskDB) GetReplay(id uuid.UUID) (parser.Record, error) {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	record, ok := db.replays[id]
+	if !ok {
+		return parser.Record{}, database.ErrNotFound
+	}
+	return record, nil
+}
+
+func (db *taskDB) GetReplayByOriginal(key string) (uuid.UUID, error) {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	for id, record := range db.replays {
+		if record.Original == key {
+			return id, nil
+		}
+	}
+	return uuid.Nil, database.ErrNotFound
+}
+
+func (db *taskDB) GetReplayByContent(record parser.Record) (uuid.UUID, error) {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	for id, stored := range db.replays {
+		if id == record.ID || (stored.ContentHash != "" && stored.ContentHash == record.ContentHash) {
+			return id, nil
+		}
+	}
+	return uuid.Nil, database.ErrNotFound
+}
+
+func (db *taskDB) GetOriginals(filter database.ReplayFilter) ([]database.Original, error) {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	originals := []database.Original{}
+	for id, record := range db.replays {
+		outdated := (filter.BelowVersion > 0 && record.ParserVersion < filter.BelowVersion) ||
+			(filter.BelowMappingVersion > 0 && record.MappingVersion < filter.BelowMappingVersion)
+		if (filter.BelowVersion > 0 || filter.BelowMappingVersion > 0) && !outdated {
+			continue
+		}
+		originals = append(originals, database.Original{ReplayID: id, Key: record.Original})
+	}
+	return originals, nil
+}
+
+func (db *taskDB) CreateTask(task database.Task) error {
+	return db.UpdateTask(task)
+}
+
+func (db *taskDB) UpdateTask(task database.Task) error {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	db.tasks[task.ID] = task
+	return nil
+}
+
+func (db *taskDB) GetTask(id uuid.UUID) (database.Task, error) {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	task, ok := db.tasks[id]
+	if !ok {
+		return database.Task{}, database.ErrNotFound
+	}
+	return task, nil
+}
+
+func (db *taskDB) GetTasks(statuses ...string) ([]database.Task, error) {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	tasks := []database.Task{}
+	for _, task := range db.tasks {
+		for _, status := range statuses {
+			if task.Status == status {
+				tasks = append(tasks, task)
+			}
+		}
+	}
+	return tasks, nil
+}
+
+func (db *taskDB) GetBatch(batchID uuid.UUID) ([]database.Task, error) {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	tasks := []database.Task{}
+	for _, task := range db.tasks {
+		if task.BatchID == batchID {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+func (db *taskDB) status(id uuid.UUID) string {
+	task, _ := db.GetTask(id)
+	return task.Status
+}
+
+// memBlobs is a blob store in memory
+type memBlobs struct {
+	mx    sync.Mutex
+	blobs map[string][]byte
+}
+
+func newMemBlobs() *memBlobs {
+	return &memBlobs{blobs: make(map[string][]byte)}
+}
+
+func (s *memBlobs) Put(key string, r io.Reader, size int64) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *memBlobs) Get(key string) (io.ReadCloser, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memBlobs) Exists(key string) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	_, ok := s.blobs[key]
+	return ok, nil
+}
+
+func (s *memBlobs) Delete(key string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	delete(s.blobs, key)
+	return nil
+}
+
+// newTestRegistry starts a registry spooling into a temporary directory, it's
+// stopped when the test is done
+func newTestRegistry(t *testing.T, db database.DB, blobs storage.BlobStore) *Registry {
+	t.Helper()
+
+	SetSpoolPath(t.TempDir())
+	SetTaskInterval(10 * time.Millisecond)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	r := NewRegistry(db, blobs, wg)
+	t.Cleanup(func() {
+		r.Stop()
+		wg.Wait()
+	})
+	return r
+}
+
+// setRetryPolicy changes the policy of the class for the duration of the test
+func setRetryPolicy(t *testing.T, class ErrorClass, policy RetryPolicy) {
+	previous := RetryPolicyFor(class)
+	SetRetryPolicy(class, policy)
+	t.Cleanup(func() { SetRetryPolicy(class, previous) })
+}
+
+// spool writes a file into the spool like an upload
+func spool(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	filename := filepath.Join(SpoolPath(), name)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatalf("Failed to spool %s: %v", name, err)
+	}
+	return filename
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("..", "parser", "testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %s: %v", name, err)
+	}
+	return data
+}
+
+// waitFor polls until cond holds or fails the test after a while
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestProcessFile(t *testing.T) {
+	setRetryPolicy(t, ClassDatabase, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})
+
+	tests := []struct {
+		name     string
+		data     []byte
+		saveErrs []error
+		status   Status
+		spooled  bool
+		kept     bool
+	}{
+		{"stored", readFixture(t, "match.xml"), nil, OK, false, true},
+		{"broken replay", []byte("not a replay"), nil, Failed, false, false},
+		{"database keeps failing", readFixture(t, "match.xml"), []error{errConnRefused, errConnRefused}, Dead, false, true},
+		{"database recovers", readFixture(t, "match.xml"), []error{errConnRefused}, OK, false, true},
+		{"database rejects the record", readFixture(t, "match.xml"), []error{&pgconn.PgError{Code: "23514"}}, Failed, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTaskDB()
+			db.saveErrs = tt.saveErrs
+			blobs := newMemBlobs()
+			r := newTestRegistry(t, db, blobs)
+
+			filename := spool(t, "upload.bbrz", tt.data)
+			id, err := r.ProcessFile(filename)
+			if err != nil {
+				t.Fatalf("ProcessFile() error = %v", err)
+			}
+			waitFor(t, "task to finish", func() bool { return db.status(id) == tt.status.String() })
+
+			if _, err := os.Stat(filename); (err == nil) != tt.spooled {
+				t.Errorf("spooled file exists = %v, want %v", err == nil, tt.spooled)
+			}
+			key, _ := storage.Key(bytes.NewReader(tt.data))
+			if kept, _ := blobs.Exists(key); kept != tt.kept {
+				t.Errorf("file in blob store = %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestRetryRestoresSpooledFile(t *testing.T) {
+	setRetryPolicy(t, ClassDatabase, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})
+
+	db := newTaskDB()
+	db.saveErrs = []error{errConnRefused, errConnRefused}
+	r := newTestRegistry(t, db, newMemBlobs())
+
+	filename := spool(t, "upload.bbrz", readFixture(t, "match.xml"))
+	id, err := r.ProcessFile(filename)
+	if err != nil {
+		t.Fatalf("ProcessFile() error = %v", err)
+	}
+	waitFor(t, "task to die", func() bool { return db.status(id) == Dead.String() })
+
+	if err := r.Retry(id); err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	waitFor(t, "retried task to finish", func() bool { return db.status(id) == OK.String() })
+
+	if err := r.Retry(id); !errors.Is(err, ErrNotDead) {
+		t.Errorf("Retry() of a stored task = %v, want %v", err, ErrNotDead)
+	}
+}
+
+func TestTaskList(t *testing.T) {
+	setRetryPolicy(t, ClassFile, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Minute})
+	failure := errors.New("unexpected EOF")
+
+	tests := []struct {
+		name   string
+		apply  func(l *TaskList, id uuid.UUID) (Task, bool)
+		ok     bool
+		status Status
+		listed bool
+	}{
+		{
+			name:   "update",
+			apply:  func(l *TaskList, id uuid.UUID) (Task, bool) { return l.Update(Update{TaskID: id, Status: Processing}) },
+			ok:     true,
+			status: Processing,
+			listed: true,
+		},
+		{
+			name: "update of an unknown task",
+			apply: func(l *TaskList, id uuid.UUID) (Task, bool) {
+				return l.Update(Update{TaskID: uuid.New(), Status: Processing})
+			},
+			listed: true,
+		},
+		{
+			name: "reschedule",
+			apply: func(l *TaskList, id uuid.UUID) (Task, bool) {
+				return l.Reschedule(Update{TaskID: id, Status: Failed, Error: failure, Class: ClassFile})
+			},
+			ok:     true,
+			status: Waiting,
+			listed: true,
+		},
+		{
+			name: "reschedule without attempts left",
+			apply: func(l *TaskList, id uuid.UUID) (Task, bool) {
+				return l.Reschedule(Update{TaskID: id, Status: Failed, Error: failure, Class: ClassParse})
+			},
+			listed: true,
+		},
+		{
+			name: "finish",
+			apply: func(l *TaskList, id uuid.UUID) (Task, bool) {
+				return l.Finish(Update{TaskID: id, Status: Failed, Error: failure, Class: ClassParse})
+			},
+			ok:     true,
+			status: Failed,
+		},
+		{
+			name:   "finish of an unknown task",
+			apply:  func(l *TaskList, id uuid.UUID) (Task, bool) { return l.Finish(Update{TaskID: uuid.New(), Status: OK}) },
+			listed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewTaskList()
+			id := uuid.New()
+			l.Add(Task{ID: id, Status: Waiting})
+
+			got, ok := tt.apply(l, id)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got.Status != tt.status {
+				t.Errorf("Status = %s, want %s", got.Status, tt.status)
+			}
+
+			// The returned task is a copy, changing it mustn't touch the list
+			got.Filename = "changed"
+			task, listed := l.Snapshot(id)
+			if listed != tt.listed {
+				t.Fatalf("Snapshot() ok = %v, want %v", listed, tt.listed)
+			}
+			if listed && task.Filename != "" {
+				t.Errorf("Filename = %s, the list was changed through a copy", task.Filename)
+			}
+		})
+	}
+}
+
+func TestTaskListQueue(t *testing.T) {
+	l := NewTaskList()
+	l.Add(Task{ID: uuid.New(), Status: Waiting})
+	l.Add(Task{ID: uuid.New(), Status: Waiting, NextAttempt: time.Now().Add(time.Hour)})
+	l.Add(Task{ID: uuid.New(), Status: Processing})
+
+	queue := make(chan Task, 2)
+	l.Queue(time.Now(), queue)
+	l.Queue(time.Now(), queue)
+	if len(queue) != 1 {
+		t.Errorf("Queue() queued %d tasks, want 1", len(queue))
+	}
+}
+
+func TestTaskListConcurrent(t *testing.T) {
+	l := NewTaskList()
+	ids := make([]uuid.UUID, 50)
+	for i := range ids {
+		ids[i] = uuid.New()
+		l.Add(Task{ID: ids[i], Status: Waiting})
+	}
+
+	queue := make(chan Task, len(ids))
+	wg := &sync.WaitGroup{}
+	for _, id := range ids {
+		wg.Add(3)
+		go func(id uuid.UUID) {
+			defer wg.Done()
+			l.Update(Update{TaskID: id, Status: Processing})
+			l.Finish(Update{TaskID: id, Status: OK})
+		}(id)
+		go func(id uuid.UUID) {
+			defer wg.Done()
+			if task, ok := l.Snapshot(id); ok {
+				_ = task.persisted()
+			}
+		}(id)
+		go func() {
+			defer wg.Done()
+			l.Queue(time.Now(), queue)
+			l.Range(func(id uuid.UUID, task Task) { _ = task.Status })
+		}()
+	}
+	wg.Wait()
+
+	count := 0
+	l.Range(func(id uuid.UUID, task Task) { count++ })
+	if count != 0 {
+		t.Errorf("%d tasks left in the list, want 0", count)
+	}
+}
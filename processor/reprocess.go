@@ -0,0 +1,370 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/helper"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/gobbler-inc/gobblerd/storage"
+	"github.com/google/uuid"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ReprocessRunning  = "running"
+	ReprocessFinished = "finished"
+	// ReprocessStopped jobs were interrupted by a shutdown, running them again picks up the rest
+	ReprocessStopped = "stopped"
+)
+
+// ReprocessLocation is the URL the progress of the reprocessing job can be followed at
+const ReprocessLocation = "/api/admin/reprocess"
+
+var ErrReprocessRunning = errors.New("A reprocessing job is already running")
+
+// ErrPartialReprocess is returned when only part of a replay that's stored completely could be read again
+var ErrPartialReprocess = errors.New("Only part of the replay could be read, keeping the complete record")
+
+// ReprocessJob is the progress of re-parsing stored replays from their originals
+type ReprocessJob struct {
+	ID             uuid.UUID
+	Status         string
+	Filter         database.ReplayFilter
+	ParserVersion  int
+	MappingVersion int
+	Total          int
+	Done           int
+	Failed         int
+	Errors         []ReprocessError
+	StartedAt      time.Time
+	FinishedAt     *time.Time
+}
+
+type ReprocessError struct {
+	ReplayID uuid.UUID
+	Error    string
+}
+
+// maxReprocessErrors caps how many errors a job keeps, the rest are only counted and logged
+const maxReprocessErrors = 100
+
+// Reprocessor re-parses stored replays from the originals in the blob store
+// and rewrites their records. It runs one job at a time.
+type Reprocessor struct {
+	mx    *sync.Mutex
+	db    database.DB
+	blobs storage.BlobStore
+	job   *ReprocessJob
+
+	// progress is called with a copy of the job every time a step of it is done
+	progress func(job ReprocessJob)
+}
+
+func NewReprocessor(db database.DB, blobs storage.BlobStore) *Reprocessor {
+	return &Reprocessor{
+		mx:       &sync.Mutex{},
+		db:       db,
+		blobs:    blobs,
+		progress: func(job ReprocessJob) {},
+	}
+}
+
+// Job returns the running job or the last one that ran
+func (p *Reprocessor) Job() (ReprocessJob, bool) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.job == nil {
+		return ReprocessJob{}, false
+	}
+	return p.snapshot(), true
+}
+
+// snapshot copies the job so it can be handed out while it's running, the caller holds p.mx
+func (p *Reprocessor) snapshot() ReprocessJob {
+	job := *p.job
+	job.Errors = append(make([]ReprocessError, 0, len(p.job.Errors)), p.job.Errors...)
+	return job
+}
+
+// Run reprocesses the replays matching the filter and returns when it's done or stop is closed
+func (p *Reprocessor) Run(filter database.ReplayFilter, stop <-chan struct{}) (ReprocessJob, error) {
+	originals, err := p.prepare(filter)
+	if err != nil {
+		return ReprocessJob{}, err
+	}
+	return p.run(originals, stop), nil
+}
+
+// prepare starts a new job with the replays matching the filter
+func (p *Reprocessor) prepare(filter database.ReplayFilter) ([]database.Original, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.job != nil && p.job.Status == ReprocessRunning {
+		return nil, ErrReprocessRunning
+	}
+
+	originals, err := p.db.GetOriginals(filter)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get replays to reprocess: %w", err)
+	}
+
+	// Run from the command line there's no registry that created the spool
+	if err := os.MkdirAll(SpoolPath(), 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create spool directory: %w", err)
+	}
+
+	p.job = &ReprocessJob{
+		ID:             uuid.New(),
+		Status:         ReprocessRunning,
+		Filter:         filter,
+		ParserVersion:  parser.Version,
+		MappingVersion: parser.MappingsVersion(),
+		Total:          len(originals),
+		Errors:         make([]ReprocessError, 0),
+		StartedAt:      time.Now(),
+	}
+
+	logger.WithFields(log.Fields{
+		"job_id":          p.job.ID.String(),
+		"replays":         len(originals),
+		"parser_version":  parser.Version,
+		"mapping_version": p.job.MappingVersion,
+	}).Info("Started reprocessing replays")
+
+	return originals, nil
+}
+
+func (p *Reprocessor) run(originals []database.Original, stop <-chan struct{}) ReprocessJob {
+	// Tell clients about the job before the first replay is done
+	p.mx.Lock()
+	job := p.snapshot()
+	p.mx.Unlock()
+	p.progress(job)
+
+	status := ReprocessFinished
+replays:
+	for _, original := range originals {
+		select {
+		case <-stop:
+			status = ReprocessStopped
+			break replays
+		default:
+		}
+
+		err := p.reprocess(original)
+
+		p.mx.Lock()
+		p.job.Done++
+		if err != nil {
+			p.job.Failed++
+			if len(p.job.Errors) < maxReprocessErrors {
+				p.job.Errors = append(p.job.Errors, ReprocessError{ReplayID: original.ReplayID, Error: err.Error()})
+			}
+		}
+		job := p.snapshot()
+		p.mx.Unlock()
+
+		if err != nil {
+			logger.WithError(err).WithField("replay_id", original.ReplayID.String()).Error("Failed to reprocess replay")
+		}
+		// Big jobs would push everything else out of the event history otherwise
+		if job.Done%reprocessProgressStep(job.Total) == 0 {
+			logger.WithFields(log.Fields{
+				"job_id": job.ID.String(),
+				"done":   job.Done,
+				"total":  job.Total,
+				"failed": job.Failed,
+			}).Info("Reprocessing replays")
+			p.progress(job)
+		}
+	}
+
+	p.mx.Lock()
+	finishedAt := time.Now()
+	p.job.Status = status
+	p.job.FinishedAt = &finishedAt
+	job = p.snapshot()
+	p.mx.Unlock()
+
+	logger.WithFields(log.Fields{
+		"job_id": job.ID.String(),
+		"status": job.Status,
+		"done":   job.Done,
+		"total":  job.Total,
+		"failed": job.Failed,
+	}).Info("Finished reprocessing replays")
+	p.progress(job)
+
+	return job
+}
+
+// reprocessProgressStep reports progress about every percent of the job
+func reprocessProgressStep(total int) int {
+	if total < 100 {
+		return 1
+	}
+	return total / 100
+}
+
+// reprocess parses the original of a stored replay again and replaces its
+// record. The replay keeps its ID even if the parser would derive another one now.
+func (p *Reprocessor) reprocess(original database.Original) error {
+	blob, err := p.blobs.Get(original.Key)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	// The formats need random access so the original is copied to the spool first
+	f, err := os.CreateTemp(SpoolPath(), "reprocess-*")
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name()) // nolint
+	defer f.Close()
+
+	size, err := io.Copy(f, blob)
+	if err != nil {
+		return fmt.Errorf("Failed to copy original %s: %w", original.Key, err)
+	}
+
+	record, err := parseFile(f, size)
+	if err != nil {
+		return err
+	}
+
+	// A salvage must not replace a complete record, the replay is left as it is
+	if record.Partial {
+		stored, err := p.db.GetReplay(original.ReplayID)
+		if err != nil {
+			return fmt.Errorf("Failed to get stored replay: %w", err)
+		}
+		if !stored.Partial {
+			return fmt.Errorf("%w: %s", ErrPartialReprocess, record.PartialReason)
+		}
+	}
+	record.ID = original.ReplayID
+	record.Original = original.Key
+
+	return p.db.UpdateReplay(record)
+}
+
+// Reprocess starts a job in the background, it's stopped along with the registry
+func (r *Registry) Reprocess(filter database.ReplayFilter) (ReprocessJob, error) {
+	// The job must join r.wg before the registry stops waiting for it
+	r.mx.Lock()
+	select {
+	case <-r.stopping:
+		r.mx.Unlock()
+		return ReprocessJob{}, ErrStopped
+	default:
+	}
+	r.wg.Add(1)
+	r.mx.Unlock()
+
+	originals, err := r.reprocessor.prepare(filter)
+	if err != nil {
+		r.wg.Done()
+		return ReprocessJob{}, err
+	}
+
+	go func() {
+		defer r.wg.Done()
+		r.reprocessor.run(originals, r.stopping)
+	}()
+
+	job, _ := r.reprocessor.Job()
+	return job, nil
+}
+
+func (r *Registry) publishReprocess(job ReprocessJob) {
+	r.events.publish(Event{Kind: EventReprocess, Reprocess: &job})
+}
+
+// ParseReplayFilter reads a filter from the query of a request: any number of
+// id, a series and outdated=true for the replays created by an older parser
+// version or with older ID mappings
+func ParseReplayFilter(query url.Values) (database.ReplayFilter, error) {
+	filter := database.ReplayFilter{
+		IDs: make([]uuid.UUID, 0),
+	}
+
+	for _, value := range query["id"] {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid replay ID %s: %w", value, err)
+		}
+		filter.IDs = append(filter.IDs, id)
+	}
+
+	if value := query.Get("series"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid series ID %s: %w", value, err)
+		}
+		filter.SeriesID = id
+	}
+
+	if value := query.Get("outdated"); value != "" {
+		outdated, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid value %s for outdated: %w", value, err)
+		}
+		if outdated {
+			filter.BelowVersion = parser.Version
+			filter.BelowMappingVersion = parser.MappingsVersion()
+		}
+	}
+
+	return filter, nil
+}
+
+// HandleReprocess serves POST /api/admin/reprocess, without a filter every stored replay is reprocessed
+func (r *Registry) HandleReprocess(w http.ResponseWriter, req *http.Request) {
+	filter, err := ParseReplayFilter(req.URL.Query())
+	if err != nil {
+		logger.WithError(err).Error("Failed to parse reprocessing filter")
+		helper.E(w, http.StatusBadRequest)
+		return
+	}
+
+	job, err := r.Reprocess(filter)
+	switch {
+	case errors.Is(err, ErrReprocessRunning):
+		helper.E(w, http.StatusConflict)
+		return
+	case errors.Is(err, ErrStopped):
+		helper.E(w, http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		logger.WithError(err).Error("Failed to start reprocessing")
+		helper.E(w, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", ReprocessLocation)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// HandleReprocessStatus serves GET /api/admin/reprocess with the running or last job
+func (r *Registry) HandleReprocessStatus(w http.ResponseWriter, req *http.Request) {
+	job, ok := r.reprocessor.Job()
+	if !ok {
+		helper.E(w, http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
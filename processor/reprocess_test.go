@@ -0,0 +1,177 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/gobbler-inc/gobblerd/database"
+	"github.com/gobbler-inc/gobblerd/parser"
+	"github.com/gobbler-inc/gobblerd/storage"
+	"github.com/google/uuid"
+)
+
+func TestParseReplayFilter(t *testing.T) {
+	id := uuid.New()
+
+	tests := []struct {
+		name    string
+		query   string
+		want    database.ReplayFilter
+		wantErr bool
+	}{
+		{"everything", "", database.ReplayFilter{IDs: []uuid.UUID{}}, false},
+		{"single replay", "id=" + id.String(), database.ReplayFilter{IDs: []uuid.UUID{id}}, false},
+		{"outdated", "outdated=true", database.ReplayFilter{IDs: []uuid.UUID{}, BelowVersion: parser.Version, BelowMappingVersion: parser.MappingsVersion()}, false},
+		{"not outdated", "outdated=false", database.ReplayFilter{IDs: []uuid.UUID{}}, false},
+		{"invalid ID", "id=12", database.ReplayFilter{}, true},
+		{"invalid outdated", "outdated=maybe", database.ReplayFilter{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			filter, err := ParseReplayFilter(query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReplayFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(filter.IDs) != len(tt.want.IDs) || (len(filter.IDs) > 0 && filter.IDs[0] != tt.want.IDs[0]) {
+				t.Errorf("IDs = %v, want %v", filter.IDs, tt.want.IDs)
+			}
+			if filter.BelowVersion != tt.want.BelowVersion || filter.BelowMappingVersion != tt.want.BelowMappingVersion {
+				t.Errorf("ParseReplayFilter() = %d, %d, want %d, %d", filter.BelowVersion, filter.BelowMappingVersion, tt.want.BelowVersion, tt.want.BelowMappingVersion)
+			}
+		})
+	}
+}
+
+func TestParseStampsMappingVersion(t *testing.T) {
+	record, err := parser.Parse(bytes.NewReader(readFixture(t, "match.xml")))
+	if err != nil {
+		t.Fatalf("Failed to parse fixture: %v", err)
+	}
+	if record.MappingVersion == 0 || record.MappingVersion != parser.MappingsVersion() {
+		t.Errorf("MappingVersion = %d, want %d", record.MappingVersion, parser.MappingsVersion())
+	}
+}
+
+func TestReprocess(t *testing.T) {
+	SetSpoolPath(t.TempDir())
+
+	match := readFixture(t, "match.xml")
+	// Cut off in the middle of the match, only a partial record can be salvaged
+	truncated := match[:bytes.Index(match, []byte("<PlayerId>12</PlayerId>"))]
+
+	tests := []struct {
+		name        string
+		original    []byte
+		stored      parser.Record
+		wantErr     error
+		wantPartial bool
+	}{
+		{"older parser", match, parser.Record{ParserVersion: parser.Version - 1, MappingVersion: parser.MappingsVersion()}, nil, false},
+		{"older mappings", match, parser.Record{ParserVersion: parser.Version, MappingVersion: parser.MappingsVersion() - 1}, nil, false},
+		{"salvaged again", truncated, parser.Record{Partial: true, PartialReason: "stored"}, nil, true},
+		{"salvage of a complete record", truncated, parser.Record{PartialReason: "stored"}, ErrPartialReprocess, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTaskDB()
+			blobs := newMemBlobs()
+
+			key, err := storage.Key(bytes.NewReader(tt.original))
+			if err != nil {
+				t.Fatalf("Key() error = %v", err)
+			}
+			if err := blobs.Put(key, bytes.NewReader(tt.original), int64(len(tt.original))); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			stored := tt.stored
+			stored.ID = uuid.New()
+			stored.Original = key
+			db.SaveReplay(stored) // nolint
+
+			p := NewReprocessor(db, blobs)
+			filter, _ := ParseReplayFilter(url.Values{"outdated": {"true"}})
+			job, err := p.Run(filter, make(chan struct{}))
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if job.Status != ReprocessFinished || job.Done != 1 {
+				t.Fatalf("job = %s with %d done, want finished with 1", job.Status, job.Done)
+			}
+
+			record, _ := db.GetReplay(stored.ID)
+			if tt.wantErr != nil {
+				if job.Failed != 1 || len(job.Errors) != 1 {
+					t.Fatalf("job failed %d replays, want 1", job.Failed)
+				}
+				if record.PartialReason != "stored" || record.Partial {
+					t.Errorf("stored record was replaced by %+v", record)
+				}
+				return
+			}
+
+			if job.Failed != 0 {
+				t.Fatalf("job failed %d replays: %v", job.Failed, job.Errors)
+			}
+			if record.Partial != tt.wantPartial || record.PartialReason == "stored" {
+				t.Errorf("Partial = %v (%s), want %v and a new record", record.Partial, record.PartialReason, tt.wantPartial)
+			}
+			if record.ParserVersion != parser.Version || record.MappingVersion != parser.MappingsVersion() {
+				t.Errorf("versions = %d, %d, want %d, %d", record.ParserVersion, record.MappingVersion, parser.Version, parser.MappingsVersion())
+			}
+
+			// Up to date now so it's no longer picked up as outdated
+			if originals, _ := db.GetOriginals(filter); len(originals) != 0 {
+				t.Errorf("%d outdated replays after reprocessing, want 0", len(originals))
+			}
+		})
+	}
+}
+
+func TestReprocessAfterStop(t *testing.T) {
+	SetSpoolPath(t.TempDir())
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	r := NewRegistry(newTaskDB(), newMemBlobs(), wg)
+	r.Stop()
+	wg.Wait()
+
+	if _, err := r.Reprocess(database.ReplayFilter{}); !errors.Is(err, ErrStopped) {
+		t.Errorf("Reprocess() = %v, want %v", err, ErrStopped)
+	}
+}
+
+func TestReprocessWhileStopping(t *testing.T) {
+	SetSpoolPath(t.TempDir())
+
+	for i := 0; i < 20; i++ {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		r := NewRegistry(newTaskDB(), newMemBlobs(), wg)
+
+		started := make(chan error)
+		go func() {
+			_, err := r.Reprocess(database.ReplayFilter{})
+			started <- err
+		}()
+		r.Stop()
+		wg.Wait()
+
+		// Either the job started before the registry waited for it or it was turned down
+		if err := <-started; err != nil && !errors.Is(err, ErrStopped) {
+			t.Fatalf("Reprocess() = %v, want nil or %v", err, ErrStopped)
+		}
+		if job, ok := r.reprocessor.Job(); ok && job.Status == ReprocessRunning {
+			t.Fatalf("job is still running after the registry stopped")
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// ErrorClass groups the errors of a task by how likely a retry is to help
+type ErrorClass string
+
+const (
+	// ClassParse is a problem with the replay itself, it fails the same way every time
+	ClassParse ErrorClass = "parse"
+	// ClassFile is a problem reading the uploaded file
+	ClassFile ErrorClass = "file"
+	// ClassDatabase is a failure storing the record, usually a transaction that didn't go through
+	ClassDatabase ErrorClass = "database"
+	// ClassRejected is a record the database turned down, e.g. because it violates a constraint
+	ClassRejected ErrorClass = "rejected"
+	// ClassStorage is a failure storing the original file in the blob store
+	ClassStorage ErrorClass = "storage"
+	// ClassPanic is a bug in the parser, it's not retried either
+	ClassPanic ErrorClass = "panic"
+)
+
+// RetryPolicy decides how often and how far apart a failed task is tried again.
+// The delay doubles with every attempt starting from BaseDelay up to MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var (
+	retryPoliciesMx = &sync.RWMutex{}
+	retryPolicies   = map[ErrorClass]RetryPolicy{
+		ClassParse:    {MaxAttempts: 1},
+		ClassPanic:    {MaxAttempts: 1},
+		ClassRejected: {MaxAttempts: 1},
+		ClassFile:     {MaxAttempts: 3, BaseDelay: 1 * time.Second, MaxDelay: 1 * time.Minute},
+		ClassDatabase: {MaxAttempts: 5, BaseDelay: 2 * time.Second, MaxDelay: 5 * time.Minute},
+		ClassStorage:  {MaxAttempts: 5, BaseDelay: 2 * time.Second, MaxDelay: 5 * time.Minute},
+	}
+)
+
+func RetryPolicyFor(class ErrorClass) RetryPolicy {
+	retryPoliciesMx.RLock()
+	defer retryPoliciesMx.RUnlock()
+
+	policy, ok := retryPolicies[class]
+	if !ok {
+		return RetryPolicy{MaxAttempts: 1}
+	}
+	return policy
+}
+
+func SetRetryPolicy(class ErrorClass, policy RetryPolicy) {
+	retryPoliciesMx.Lock()
+	defer retryPoliciesMx.Unlock()
+
+	retryPolicies[class] = policy
+}
+
+// Retries reports whether a task that failed its attempt-th attempt should be tried again
+func (p RetryPolicy) Retries(attempt int) bool {
+	return attempt < p.MaxAttempts
+}
+
+// Backoff is how long to wait after the attempt-th attempt failed
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// Postgres error codes that are worth another attempt
+const (
+	pgSerializationFailure = "40001"
+	pgConnectionException  = "08"
+)
+
+// databaseErrorClass tells a transaction that didn't go through or a lost
+// connection apart from a statement the database turned down, which fails the
+// same way every time
+func databaseErrorClass(err error) ErrorClass {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if pgErr.Code == pgSerializationFailure || strings.HasPrefix(pgErr.Code, pgConnectionException) {
+			return ClassDatabase
+		}
+		return ClassRejected
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || pgconn.Timeout(err) {
+		return ClassDatabase
+	}
+	return ClassRejected
+}
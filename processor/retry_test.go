@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		class   ErrorClass
+		attempt int
+		want    bool
+	}{
+		{ClassParse, 1, false},
+		{ClassPanic, 1, false},
+		{ClassRejected, 1, false},
+		{ClassFile, 2, true},
+		{ClassFile, 3, false},
+		{ClassDatabase, 4, true},
+		{ClassDatabase, 5, false},
+		{"unknown", 1, false},
+	}
+
+	for _, tt := range tests {
+		if got := RetryPolicyFor(tt.class).Retries(tt.attempt); got != tt.want {
+			t.Errorf("Retries(%s, %d) = %v, want %v", tt.class, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestDatabaseErrorClass(t *testing.T) {
+	wrap := func(err error) error { return fmt.Errorf("Error executing statement: %w", err) }
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"serialization failure", wrap(&pgconn.PgError{Code: "40001"}), ClassDatabase},
+		{"connection failure", wrap(&pgconn.PgError{Code: "08006"}), ClassDatabase},
+		{"connection refused", wrap(errConnRefused), ClassDatabase},
+		{"connection closed", wrap(io.ErrUnexpectedEOF), ClassDatabase},
+		{"unique violation", wrap(&pgconn.PgError{Code: "23505"}), ClassRejected},
+		{"check violation", wrap(&pgconn.PgError{Code: "23514"}), ClassRejected},
+		{"undefined column", wrap(&pgconn.PgError{Code: "42703"}), ClassRejected},
+		{"unknown", errors.New("json: unsupported value"), ClassRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := databaseErrorClass(tt.err); got != tt.want {
+				t.Errorf("databaseErrorClass() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
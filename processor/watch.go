@@ -0,0 +1,278 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Subfolders of a watched folder that processed files are moved to
+const (
+	watchDoneDir   = "done"
+	watchFailedDir = "failed"
+)
+
+// watchErrorSuffix is appended to the name of a failed file for the sidecar that explains why it failed
+const watchErrorSuffix = ".error"
+
+// folderWatcher polls the drop folders for new replays. A file is only picked
+// up once its size and modification time stayed the same between two polls so
+// files that are still being copied in aren't read half way.
+type folderWatcher struct {
+	mx    *sync.Mutex
+	seen  map[string]os.FileInfo
+	stuck map[string]bool
+}
+
+func newFolderWatcher() *folderWatcher {
+	return &folderWatcher{
+		mx:    &sync.Mutex{},
+		seen:  make(map[string]os.FileInfo),
+		stuck: make(map[string]bool),
+	}
+}
+
+func (r *Registry) startWatching() {
+	paths := WatchPaths()
+	if len(paths) == 0 {
+		return
+	}
+
+	for _, path := range paths {
+		for _, sub := range []string{watchDoneDir, watchFailedDir} {
+			if err := os.MkdirAll(filepath.Join(path, sub), 0755); err != nil {
+				logger.WithError(err).WithField("path", path).Error("Failed to prepare watched folder")
+			}
+		}
+	}
+
+	go func() {
+		logger.WithFields(log.Fields{
+			"paths":    strings.Join(paths, ", "),
+			"interval": WatchInterval().String(),
+		}).Info("Watching drop folders")
+		t := time.NewTicker(WatchInterval())
+		for {
+			select {
+			case <-t.C:
+				for _, path := range paths {
+					r.pollFolder(path)
+				}
+			case <-r.stopping:
+				t.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (r *Registry) pollFolder(path string) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		logger.WithError(err).WithField("path", path).Error("Failed to read watched folder")
+		return
+	}
+
+	inFlight := make(map[string]bool)
+	r.tasks.Range(func(id uuid.UUID, task Task) {
+		inFlight[task.Filename] = true
+	})
+
+	w := r.watcher
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	w.prune(path, entries)
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isReplayEntry(entry.Name()) {
+			continue
+		}
+
+		filename := filepath.Join(path, entry.Name())
+		if inFlight[filename] || w.stuck[filename] {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		previous, ok := w.seen[filename]
+		w.seen[filename] = info
+		if !ok || previous.Size() != info.Size() || !previous.ModTime().Equal(info.ModTime()) {
+			continue
+		}
+
+		if err := r.Accepting(); err != nil {
+			// Whatever is left is picked up on one of the next polls
+			logger.WithError(err).WithField("path", path).Debug("Queue is busy, leaving files in drop folder")
+			return
+		}
+
+		id, err := r.enqueue(filename, entry.Name(), uuid.Nil)
+		var known *KnownError
+		if errors.As(err, &known) {
+			delete(w.seen, filename)
+			if err := skipKnown(path, filename, known); err != nil {
+				w.stuck[filename] = true
+				logger.WithError(err).WithField("filename", filename).Error("Failed to skip known file")
+			}
+			continue
+		}
+		if err != nil {
+			logger.WithError(err).WithField("filename", filename).Error("Failed to queue file from drop folder")
+			continue
+		}
+		delete(w.seen, filename)
+		logger.WithFields(log.Fields{
+			"id":       id.String(),
+			"filename": filename,
+		}).Debug("Queued file from drop folder")
+	}
+}
+
+// prune forgets the files of the folder that aren't in it anymore, whether they
+// were moved away, deleted or never settled. The caller holds w.mx.
+func (w *folderWatcher) prune(path string, entries []os.DirEntry) {
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		present[filepath.Join(path, entry.Name())] = true
+	}
+
+	gone := func(filename string) bool {
+		root, ok := watchRoot(filename)
+		return ok && root == filepath.Clean(path) && !present[filename]
+	}
+	for filename := range w.seen {
+		if gone(filename) {
+			delete(w.seen, filename)
+		}
+	}
+	for filename := range w.stuck {
+		if gone(filename) {
+			delete(w.stuck, filename)
+		}
+	}
+}
+
+// watchRoot returns the drop folder a file belongs to. Files retried from
+// failed/ still belong to their folder so they end up in done/ when they succeed.
+func watchRoot(filename string) (string, bool) {
+	dir := filepath.Dir(filename)
+	for _, path := range WatchPaths() {
+		path = filepath.Clean(path)
+		if dir == path || dir == filepath.Join(path, watchFailedDir) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// finishWatched moves a file from a drop folder to done/ or failed/ once its
+// task has come to an end and returns where the file is now, failed files get
+// a sidecar with the error
+func (r *Registry) finishWatched(task Task) string {
+	root, ok := watchRoot(task.Filename)
+	if !ok {
+		return task.Filename
+	}
+
+	sub := watchDoneDir
+	if task.Status == Failed || task.Status == Dead {
+		sub = watchFailedDir
+	}
+
+	target := watchTarget(root, sub, task.Filename, task.ID)
+	if target == task.Filename {
+		return target
+	}
+
+	loggerContext := logger.WithFields(log.Fields{
+		"id":       task.ID.String(),
+		"filename": task.Filename,
+		"target":   target,
+	})
+
+	if err := os.Rename(task.Filename, target); err != nil {
+		// Keep the poller from queueing the file again
+		r.watcher.mx.Lock()
+		r.watcher.stuck[task.Filename] = true
+		r.watcher.mx.Unlock()
+		loggerContext.WithError(err).Error("Failed to move processed file out of drop folder")
+		return task.Filename
+	}
+
+	// A successful retry leaves the sidecar of the earlier failure behind otherwise
+	os.Remove(task.Filename + watchErrorSuffix) // nolint
+
+	if sub == watchFailedDir {
+		if err := os.WriteFile(target+watchErrorSuffix, []byte(watchErrorReport(task)), 0644); err != nil {
+			loggerContext.WithError(err).Error("Failed to write error file")
+		}
+	}
+
+	loggerContext.Debug("Moved processed file")
+	return target
+}
+
+// watchTarget is where a file from a drop folder is moved to, the ID tells
+// apart files with the same name
+func watchTarget(root, sub, filename string, id uuid.UUID) string {
+	target := filepath.Join(root, sub, filepath.Base(filename))
+	if target == filename {
+		return target
+	}
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(target)
+		target = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(target, ext), id.String()[:8], ext)
+	}
+	return target
+}
+
+// skipKnown moves a file that's already known straight to done/ since there's
+// nothing left to do with it
+func skipKnown(root, filename string, known *KnownError) error {
+	id := known.ReplayID
+	if id == uuid.Nil {
+		id = known.TaskID
+	}
+
+	target := watchTarget(root, watchDoneDir, filename, id)
+	if err := os.Rename(filename, target); err != nil {
+		return fmt.Errorf("Failed to move known file out of drop folder: %w", err)
+	}
+
+	logger.WithFields(log.Fields{
+		"filename":  filename,
+		"target":    target,
+		"task_id":   known.TaskID.String(),
+		"replay_id": known.ReplayID.String(),
+	}).Info("Skipped file from drop folder that's already known")
+	return nil
+}
+
+func watchErrorReport(task Task) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "task: %s\n", task.ID.String())
+	fmt.Fprintf(&b, "status: %s\n", task.Status.String())
+	fmt.Fprintf(&b, "attempts: %d\n", task.Attempts)
+	if task.ErrorKind != "" {
+		fmt.Fprintf(&b, "error_kind: %s\n", task.ErrorKind)
+	}
+	if task.ErrorClass != "" {
+		fmt.Fprintf(&b, "error_class: %s\n", task.ErrorClass)
+	}
+	if task.Error != nil {
+		fmt.Fprintf(&b, "error: %s\n", task.Error.Error())
+	}
+	return b.String()
+}
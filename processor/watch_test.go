@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// watchFolder makes a temporary drop folder the only watched one for the duration of the test
+func watchFolder(t *testing.T) string {
+	t.Helper()
+
+	path := t.TempDir()
+	previousPaths, previousInterval := WatchPaths(), WatchInterval()
+	SetWatchPaths([]string{path})
+	SetWatchInterval(10 * time.Millisecond)
+	t.Cleanup(func() {
+		SetWatchPaths(previousPaths)
+		SetWatchInterval(previousInterval)
+	})
+	return path
+}
+
+func TestFolderWatcherPrune(t *testing.T) {
+	path := watchFolder(t)
+	other := t.TempDir()
+
+	for _, name := range []string{"copying.bbrz", "stuck.bbrz"} {
+		if err := os.WriteFile(filepath.Join(path, name), []byte("replay"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		t.Fatalf("Failed to read folder: %v", err)
+	}
+	info, _ := entries[0].Info()
+
+	w := newFolderWatcher()
+	for _, filename := range []string{
+		filepath.Join(path, "copying.bbrz"),
+		filepath.Join(path, "deleted.bbrz"),
+		filepath.Join(other, "elsewhere.bbrz"),
+	} {
+		w.seen[filename] = info
+	}
+	for _, filename := range []string{
+		filepath.Join(path, "stuck.bbrz"),
+		filepath.Join(path, "moved.bbrz"),
+		filepath.Join(path, watchFailedDir, "retried.bbrz"),
+	} {
+		w.stuck[filename] = true
+	}
+
+	w.prune(path, entries)
+
+	tests := []struct {
+		name  string
+		files map[string]bool
+		want  []string
+	}{
+		{"seen", keys(w.seen), []string{filepath.Join(path, "copying.bbrz"), filepath.Join(other, "elsewhere.bbrz")}},
+		{"stuck", w.stuck, []string{filepath.Join(path, "stuck.bbrz")}},
+	}
+
+	for _, tt := range tests {
+		got := make([]string, 0, len(tt.files))
+		for filename := range tt.files {
+			got = append(got, filename)
+		}
+		sort.Strings(got)
+		sort.Strings(tt.want)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func keys(seen map[string]os.FileInfo) map[string]bool {
+	result := make(map[string]bool, len(seen))
+	for filename := range seen {
+		result[filename] = true
+	}
+	return result
+}
+
+func TestWatchFolder(t *testing.T) {
+	path := watchFolder(t)
+	db := newTaskDB()
+	r := newTestRegistry(t, db, newMemBlobs())
+
+	files := map[string][]byte{
+		"match.bbrz":  readFixture(t, "match.xml"),
+		"broken.bbrz": []byte("not a replay"),
+		"notes.txt":   []byte("left alone"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(path, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+	}{
+		{"stored", filepath.Join(path, watchDoneDir, "match.bbrz")},
+		{"failed", filepath.Join(path, watchFailedDir, "broken.bbrz")},
+		{"error report", filepath.Join(path, watchFailedDir, "broken.bbrz"+watchErrorSuffix)},
+		{"not a replay", filepath.Join(path, "notes.txt")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waitFor(t, tt.filename, func() bool {
+				_, err := os.Stat(tt.filename)
+				return err == nil
+			})
+		})
+	}
+
+	// Files that were picked up are forgotten once they're gone from the folder
+	waitFor(t, "watcher to forget the files", func() bool {
+		r.watcher.mx.Lock()
+		defer r.watcher.mx.Unlock()
+		return len(r.watcher.seen) == 0 && len(r.watcher.stuck) == 0
+	})
+
+	report, err := os.ReadFile(filepath.Join(path, watchFailedDir, "broken.bbrz"+watchErrorSuffix))
+	if err != nil {
+		t.Fatalf("Failed to read error report: %v", err)
+	}
+	if !strings.Contains(string(report), "status: failed") {
+		t.Errorf("error report = %s, want the failed status", report)
+	}
+}
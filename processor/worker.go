@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gobbler-inc/gobblerd/helper"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrQueueFull = errors.New("Task queue is full")
+	ErrStopped   = errors.New("Registry is shutting down")
+)
+
+// Accepting reports whether a new task would be taken right now
+func (r *Registry) Accepting() error {
+	return r.accepting(1)
+}
+
+// accepting reports whether n new tasks would fit in the queue
+func (r *Registry) accepting(n int) error {
+	select {
+	case <-r.stopping:
+		return ErrStopped
+	default:
+	}
+
+	if r.waiting()+n > QueueSize() {
+		rejectedCount.Add(int64(n))
+		return ErrQueueFull
+	}
+
+	return nil
+}
+
+// waiting counts the tasks that haven't been picked up by a worker yet
+func (r *Registry) waiting() int {
+	count := 0
+	r.tasks.Range(func(id uuid.UUID, task Task) {
+		if task.Status == Waiting {
+			count++
+		}
+	})
+	return count
+}
+
+func (r *Registry) updateQueueDepth() {
+	queueDepth.Set(int64(r.waiting()))
+}
+
+func (r *Registry) startWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	workers.Set(int64(n))
+
+	logger.WithField("workers", n).Debug("Starting workers")
+	for i := 0; i < n; i++ {
+		r.wg.Add(1)
+		go r.work()
+	}
+}
+
+func (r *Registry) work() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.stopping:
+			return
+		case task := <-r.queue:
+			// Tasks still in the queue on shutdown are left waiting for the next start
+			select {
+			case <-r.stopping:
+				return
+			default:
+			}
+
+			task, ok := r.tasks.Update(Update{TaskID: task.ID, Status: Processing})
+			if !ok {
+				continue
+			}
+
+			busyWorkers.Add(1)
+			r.updateQueueDepth()
+			r.persist(task)
+			r.processTask(task)
+			busyWorkers.Add(-1)
+		}
+	}
+}
+
+// fillQueue hands waiting tasks to the workers for as long as there's room in the queue
+func (r *Registry) fillQueue() {
+	r.tasks.Queue(time.Now(), r.queue)
+}
+
+// rejectRequest tells the client to come back later, a full queue drains on its
+// own so the client is told when to retry
+func rejectRequest(w http.ResponseWriter, err error) {
+	logger.WithError(err).Warn("Rejected request")
+	if errors.Is(err, ErrStopped) {
+		helper.E(w, http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(TaskInterval().Seconds()))))
+	helper.E(w, http.StatusTooManyRequests)
+}
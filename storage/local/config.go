@@ -0,0 +1,9 @@
+package local
+
+var (
+	path string = "/var/lib/gobblerd/blobs"
+)
+
+func Path() string { return path }
+
+func SetPath(newPath string) { path = newPath }
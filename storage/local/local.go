@@ -0,0 +1,109 @@
+package local
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gobbler-inc/gobblerd/storage"
+)
+
+// Store keeps the blobs on the local filesystem. They're spread over two levels
+// of directories named after the first bytes of the key so no single directory
+// grows too large.
+type Store struct {
+	root string
+}
+
+func New() (*Store, error) {
+	if err := os.MkdirAll(Path(), 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create blob directory %s: %w", Path(), err)
+	}
+
+	logger.WithField("path", Path()).Info("Storing blobs on the local filesystem")
+
+	return &Store{root: Path()}, nil
+}
+
+func (s *Store) path(key string) string {
+	return filepath.Join(s.root, key[0:2], key[2:4], key)
+}
+
+// Put writes the blob to a temporary file first so a failed write never leaves
+// a truncated blob behind under its key
+func (s *Store) Put(key string, r io.Reader, size int64) error {
+	if !storage.ValidKey(key) {
+		return storage.ErrInvalidKey
+	}
+
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Failed to create blob directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("Failed to create blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // nolint
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("Failed to write blob %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Failed to write blob %s: %w", key, err)
+	}
+	if n != size {
+		return fmt.Errorf("Failed to write blob %s: wrote %d bytes, expected %d", key, n, size)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("Failed to move blob %s in place: %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *Store) Get(key string) (io.ReadCloser, error) {
+	if !storage.ValidKey(key) {
+		return nil, storage.ErrInvalidKey
+	}
+
+	f, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open blob %s: %w", key, err)
+	}
+	return f, nil
+}
+
+func (s *Store) Exists(key string) (bool, error) {
+	if !storage.ValidKey(key) {
+		return false, storage.ErrInvalidKey
+	}
+
+	_, err := os.Stat(s.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to stat blob %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func (s *Store) Delete(key string) error {
+	if !storage.ValidKey(key) {
+		return storage.ErrInvalidKey
+	}
+
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove blob %s: %w", key, err)
+	}
+	return nil
+}
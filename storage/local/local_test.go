@@ -0,0 +1,141 @@
+package local
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gobbler-inc/gobblerd/storage"
+)
+
+// helloKey is the SHA-256 of "hello"
+const helloKey = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func newStore(t *testing.T) *Store {
+	t.Helper()
+
+	SetPath(filepath.Join(t.TempDir(), "blobs"))
+	s, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return s
+}
+
+func TestPut(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		content string
+		size    int64
+		fails   bool
+		err     error
+	}{
+		{"blob", helloKey, "hello", 5, false, nil},
+		{"invalid key", "../hello", "hello", 5, true, storage.ErrInvalidKey},
+		{"short write", helloKey, "hell", 5, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore(t)
+
+			err := s.Put(tt.key, strings.NewReader(tt.content), tt.size)
+			if (err != nil) != tt.fails || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Fatalf("Put() error = %v, want failure %v (%v)", err, tt.fails, tt.err)
+			}
+
+			if !storage.ValidKey(tt.key) {
+				return
+			}
+			exists, err := s.Exists(tt.key)
+			if err != nil || exists == tt.fails {
+				t.Errorf("Exists() = %v, %v, want %v", exists, err, !tt.fails)
+			}
+
+			// A failed write leaves neither the blob nor a temporary file behind
+			files, _ := os.ReadDir(filepath.Dir(s.path(tt.key)))
+			want := 1
+			if tt.fails {
+				want = 0
+			}
+			if len(files) != want {
+				t.Errorf("%d files next to the blob, want %d", len(files), want)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	s := newStore(t)
+	if err := s.Put(helloKey, strings.NewReader("hello"), 5); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		want string
+		err  error
+	}{
+		{"stored", helloKey, "hello", nil},
+		{"missing", strings.Repeat("a", 64), "", storage.ErrNotFound},
+		{"invalid key", "hello", "", storage.ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := s.Get(tt.key)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			defer rc.Close()
+
+			data, _ := io.ReadAll(rc)
+			if string(data) != tt.want {
+				t.Errorf("Get() = %q, want %q", data, tt.want)
+			}
+		})
+	}
+
+	if path := s.path(helloKey); path != filepath.Join(Path(), "2c", "f2", helloKey) {
+		t.Errorf("path() = %s, want the blob two levels down", path)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	s := newStore(t)
+	if err := s.Put(helloKey, strings.NewReader("hello"), 5); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		err  error
+	}{
+		{"stored", helloKey, nil},
+		{"deleted already", helloKey, nil},
+		{"invalid key", "../hello", storage.ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Delete(tt.key); !errors.Is(err, tt.err) {
+				t.Fatalf("Delete() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if exists, _ := s.Exists(tt.key); exists {
+				t.Errorf("Exists() = true after Delete()")
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package s3
+
+var (
+	endpoint  string = "localhost:9000"
+	bucket    string = "gobblerd"
+	region    string = "us-east-1"
+	accessKey string = ""
+	secretKey string = ""
+	useSSL    bool   = false
+)
+
+func Endpoint() string  { return endpoint }
+func Bucket() string    { return bucket }
+func Region() string    { return region }
+func AccessKey() string { return accessKey }
+func SecretKey() string { return secretKey }
+func UseSSL() bool      { return useSSL }
+
+func SetEndpoint(newEndpoint string)   { endpoint = newEndpoint }
+func SetBucket(newBucket string)       { bucket = newBucket }
+func SetRegion(newRegion string)       { region = newRegion }
+func SetAccessKey(newAccessKey string) { accessKey = newAccessKey }
+func SetSecretKey(newSecretKey string) { secretKey = newSecretKey }
+func SetUseSSL(newUseSSL bool)         { useSSL = newUseSSL }
@@ -0,0 +1,12 @@
+package s3
+
+import (
+	"github.com/gobbler-inc/gobblerd/logging"
+	"github.com/sirupsen/logrus"
+)
+
+var logger *logrus.Entry
+
+func init() {
+	logger = logging.NewLogger("blobs-s3")
+}
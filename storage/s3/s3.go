@@ -0,0 +1,243 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gobbler-inc/gobblerd/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// emptyHash is the SHA-256 of an empty payload, sent with every request without a body
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Store keeps the blobs in a bucket of an S3 compatible service like MinIO.
+// Requests use path style addressing and are signed with AWS Signature Version 4.
+type Store struct {
+	client    *http.Client
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+func New() (*Store, error) {
+	scheme := "http"
+	if UseSSL() {
+		scheme = "https"
+	}
+
+	s := &Store{
+		client:    &http.Client{Timeout: 5 * time.Minute},
+		endpoint:  &url.URL{Scheme: scheme, Host: Endpoint()},
+		bucket:    Bucket(),
+		region:    Region(),
+		accessKey: AccessKey(),
+		secretKey: SecretKey(),
+	}
+
+	if err := s.ensureBucket(); err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(log.Fields{
+		"endpoint": Endpoint(),
+		"bucket":   Bucket(),
+	}).Info("Storing blobs in S3")
+
+	return s, nil
+}
+
+// ensureBucket creates the bucket if it doesn't exist yet
+func (s *Store) ensureBucket() error {
+	res, err := s.do(http.MethodHead, "", nil, 0, emptyHash)
+	if err != nil {
+		return fmt.Errorf("Failed to check bucket %s: %w", s.bucket, err)
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+	default:
+		return fmt.Errorf("Failed to check bucket %s: %s", s.bucket, res.Status)
+	}
+
+	res, err = s.do(http.MethodPut, "", nil, 0, emptyHash)
+	if err != nil {
+		return fmt.Errorf("Failed to create bucket %s: %w", s.bucket, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to create bucket %s: %s", s.bucket, responseError(res))
+	}
+
+	logger.WithField("bucket", s.bucket).Info("Created bucket")
+	return nil
+}
+
+// Put uploads the blob. The key is the SHA-256 of the content so it doubles as
+// the payload hash and S3 verifies the upload against it.
+func (s *Store) Put(key string, r io.Reader, size int64) error {
+	if !storage.ValidKey(key) {
+		return storage.ErrInvalidKey
+	}
+
+	res, err := s.do(http.MethodPut, key, r, size, key)
+	if err != nil {
+		return fmt.Errorf("Failed to upload blob %s: %w", key, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to upload blob %s: %s", key, responseError(res))
+	}
+	return nil
+}
+
+func (s *Store) Get(key string) (io.ReadCloser, error) {
+	if !storage.ValidKey(key) {
+		return nil, storage.ErrInvalidKey
+	}
+
+	res, err := s.do(http.MethodGet, key, nil, 0, emptyHash)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download blob %s: %w", key, err)
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, storage.ErrNotFound
+	}
+
+	defer res.Body.Close()
+	return nil, fmt.Errorf("Failed to download blob %s: %s", key, responseError(res))
+}
+
+func (s *Store) Exists(key string) (bool, error) {
+	if !storage.ValidKey(key) {
+		return false, storage.ErrInvalidKey
+	}
+
+	res, err := s.do(http.MethodHead, key, nil, 0, emptyHash)
+	if err != nil {
+		return false, fmt.Errorf("Failed to check blob %s: %w", key, err)
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("Failed to check blob %s: %s", key, res.Status)
+}
+
+func (s *Store) Delete(key string) error {
+	if !storage.ValidKey(key) {
+		return storage.ErrInvalidKey
+	}
+
+	res, err := s.do(http.MethodDelete, key, nil, 0, emptyHash)
+	if err != nil {
+		return fmt.Errorf("Failed to delete blob %s: %w", key, err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return fmt.Errorf("Failed to delete blob %s: %s", key, responseError(res))
+}
+
+// do sends a signed request for the object with the key, or for the bucket itself if key is empty
+func (s *Store) do(method, key string, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	s.sign(req, payloadHash, time.Now().UTC())
+
+	return s.client.Do(req)
+}
+
+// sign adds the Authorization header of AWS Signature Version 4
+func (s *Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data)) // nolint
+	return h.Sum(nil)
+}
+
+// responseError includes the start of the error document S3 sends back
+func responseError(res *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	if len(body) == 0 {
+		return res.Status
+	}
+	return fmt.Sprintf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,197 @@
+package s3
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobbler-inc/gobblerd/storage"
+)
+
+// helloKey is the SHA-256 of "hello"
+const helloKey = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+var authorization = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=access/\d{8}/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=[0-9a-f]{64}$`)
+
+// fakeS3 is a single bucket of an S3 compatible service, it checks every
+// request is signed and that uploads match their payload hash
+type fakeS3 struct {
+	t       *testing.T
+	mx      sync.Mutex
+	bucket  bool
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if auth := req.Header.Get("Authorization"); !authorization.MatchString(auth) {
+		f.t.Errorf("%s %s has Authorization %q", req.Method, req.URL.Path, auth)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key := strings.TrimPrefix(req.URL.Path, "/gobblerd")
+	switch {
+	case key == "" && req.Method == http.MethodHead:
+		if !f.bucket {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case key == "" && req.Method == http.MethodPut:
+		f.bucket = true
+	case req.Method == http.MethodPut:
+		data, _ := io.ReadAll(req.Body)
+		if hash := req.Header.Get("X-Amz-Content-Sha256"); hash != hashHex(data) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "<Error><Code>XAmzContentSHA256Mismatch</Code></Error>") // nolint
+			return
+		}
+		f.objects[key] = data
+	case req.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodHead, req.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodGet {
+			w.Write(data) // nolint
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newStore(t *testing.T, f *fakeS3) *Store {
+	t.Helper()
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	SetEndpoint(strings.TrimPrefix(srv.URL, "http://"))
+	SetBucket("gobblerd")
+	SetAccessKey("access")
+	SetSecretKey("secret")
+
+	s, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return s
+}
+
+func TestNewCreatesBucket(t *testing.T) {
+	f := &fakeS3{t: t, objects: make(map[string][]byte)}
+	newStore(t, f)
+
+	if !f.bucket {
+		t.Errorf("New() didn't create the bucket")
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := newStore(t, &fakeS3{t: t, bucket: true, objects: make(map[string][]byte)})
+
+	if err := s.Put(helloKey, strings.NewReader("hello"), 5); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		exists bool
+		want   string
+		err    error
+	}{
+		{"stored", helloKey, true, "hello", nil},
+		{"missing", strings.Repeat("a", 64), false, "", storage.ErrNotFound},
+		{"invalid key", "../hello", false, "", storage.ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists, err := s.Exists(tt.key)
+			if exists != tt.exists || (err != nil && !errors.Is(err, tt.err)) {
+				t.Errorf("Exists() = %v, %v, want %v", exists, err, tt.exists)
+			}
+
+			rc, err := s.Get(tt.key)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			defer rc.Close()
+
+			data, _ := io.ReadAll(rc)
+			if string(data) != tt.want {
+				t.Errorf("Get() = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	s := newStore(t, &fakeS3{t: t, bucket: true, objects: make(map[string][]byte)})
+	if err := s.Put(helloKey, strings.NewReader("hello"), 5); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	for _, name := range []string{"stored", "deleted already"} {
+		if err := s.Delete(helloKey); err != nil {
+			t.Fatalf("Delete() %s error = %v", name, err)
+		}
+		if exists, _ := s.Exists(helloKey); exists {
+			t.Errorf("Exists() = true after Delete() %s", name)
+		}
+	}
+	if err := s.Delete("../hello"); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Errorf("Delete() error = %v, want %v", err, storage.ErrInvalidKey)
+	}
+}
+
+func TestPutRejected(t *testing.T) {
+	s := newStore(t, &fakeS3{t: t, bucket: true, objects: make(map[string][]byte)})
+
+	// The key doubles as the payload hash so content that doesn't match it is turned down
+	err := s.Put(helloKey, strings.NewReader("hallo"), 5)
+	if err == nil || !strings.Contains(err.Error(), "XAmzContentSHA256Mismatch") {
+		t.Errorf("Put() error = %v, want the error document", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	s := &Store{region: "us-east-1", accessKey: "access", secretKey: "secret"}
+	now := time.Date(2022, 3, 1, 20, 0, 0, 0, time.UTC)
+
+	sign := func(secret string) string {
+		s.secretKey = secret
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost:9000/gobblerd/"+helloKey, nil)
+		s.sign(req, emptyHash, now)
+		if req.Header.Get("X-Amz-Date") != "20220301T200000Z" {
+			t.Errorf("X-Amz-Date = %s, want 20220301T200000Z", req.Header.Get("X-Amz-Date"))
+		}
+		return req.Header.Get("Authorization")
+	}
+
+	first := sign("secret")
+	if !authorization.MatchString(first) {
+		t.Errorf("Authorization = %s, want a SigV4 header", first)
+	}
+	if again := sign("secret"); again != first {
+		t.Errorf("signing the same request twice gave %s and %s", first, again)
+	}
+	if other := sign("other"); other == first {
+		t.Errorf("signature doesn't depend on the secret key")
+	}
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// BlobStore keeps the original replay files. Blobs are addressed by the
+// SHA-256 of their content so storing the same file twice is a no-op.
+type BlobStore interface {
+	// Put stores size bytes read from r under key, the key has to be the hash of the content
+	Put(key string, r io.Reader, size int64) error
+	Get(key string) (io.ReadCloser, error)
+	Exists(key string) (bool, error)
+	// Delete removes the blob, deleting one that isn't there is not an error
+	Delete(key string) error
+}
+
+var (
+	ErrNotFound   = errors.New("Blob not found")
+	ErrInvalidKey = errors.New("Invalid blob key")
+)
+
+// Key returns the key of the content read from r
+func Key(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", fmt.Errorf("Failed to hash content: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func FileKey(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("Failed to open file %s: %w", filename, err)
+	}
+	defer f.Close()
+
+	return Key(f)
+}
+
+// ValidKey reports whether key looks like a hex encoded SHA-256, the backends
+// use it in paths so anything else is turned away
+func ValidKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// Store copies the file into the blob store unless it's already there and returns its key
+func Store(blobs BlobStore, filename string) (string, error) {
+	key, err := FileKey(filename)
+	if err != nil {
+		return "", err
+	}
+
+	exists, err := blobs.Exists(key)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return key, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("Failed to open file %s: %w", filename, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("Failed to stat file %s: %w", filename, err)
+	}
+
+	if err := blobs.Put(key, f, info.Size()); err != nil {
+		return "", err
+	}
+	return key, nil
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// helloKey is the SHA-256 of "hello"
+const helloKey = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"hello", "hello", helloKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Key(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("Key() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Key() = %s, want %s", got, tt.want)
+			}
+			if !ValidKey(got) {
+				t.Errorf("ValidKey(%s) = false, want true", got)
+			}
+		})
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{helloKey, true},
+		{strings.ToUpper(helloKey), true},
+		{"", false},
+		{helloKey[:63], false},
+		{helloKey + "0", false},
+		{"../../" + helloKey[6:], false},
+		{strings.Repeat("g", 64), false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidKey(tt.key); got != tt.want {
+			t.Errorf("ValidKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+// memStore is a blob store in memory that counts the uploads
+type memStore struct {
+	blobs map[string][]byte
+	puts  int
+	err   error
+}
+
+func (s *memStore) Put(key string, r io.Reader, size int64) error {
+	if s.err != nil {
+		return s.err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.puts++
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *memStore) Get(key string) (io.ReadCloser, error) {
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memStore) Exists(key string) (bool, error) {
+	_, ok := s.blobs[key]
+	return ok, s.err
+}
+
+func (s *memStore) Delete(key string) error {
+	delete(s.blobs, key)
+	return s.err
+}
+
+func TestStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "hello.bbrz")
+	if err := os.WriteFile(filename, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	unavailable := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		filename string
+		stored   bool
+		err      error
+		puts     int
+	}{
+		{"new file", filename, false, nil, 1},
+		{"stored already", filename, true, nil, 0},
+		{"store unavailable", filename, false, unavailable, 0},
+		{"missing file", filename + ".gone", false, os.ErrNotExist, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &memStore{blobs: make(map[string][]byte), err: tt.err}
+			if tt.stored {
+				s.blobs[helloKey] = []byte("hello")
+			}
+
+			key, err := Store(s, tt.filename)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Store() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+			if key != helloKey {
+				t.Errorf("Store() = %s, want %s", key, helloKey)
+			}
+			if s.puts != tt.puts {
+				t.Errorf("Store() uploaded %d times, want %d", s.puts, tt.puts)
+			}
+			if !bytes.Equal(s.blobs[helloKey], []byte("hello")) {
+				t.Errorf("stored blob = %q, want hello", s.blobs[helloKey])
+			}
+		})
+	}
+}